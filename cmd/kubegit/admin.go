@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/leaderelection"
+
+	"github.com/appspero/kube-git/pkg/controller"
+)
+
+// adminServer serves the health, readiness and debug endpoints on the admin
+// port, apart from the webhook port exposed to the git providers
+type adminServer struct {
+	controller *controller.Controller
+	// watchdog fails /healthz when the Lease isn't renewed, nil without leader
+	// election
+	watchdog *leaderelection.HealthzAdaptor
+
+	leader       int32
+	shuttingDown int32
+}
+
+// readiness is the body of /readyz
+type readiness struct {
+	InformersSynced bool `json:"informersSynced"`
+	Leader          bool `json:"leader"`
+	ShuttingDown    bool `json:"shuttingDown"`
+}
+
+func (a *adminServer) setLeader(leader bool) {
+	var v int32
+	if leader {
+		v = 1
+	}
+	atomic.StoreInt32(&a.leader, v)
+}
+
+func (a *adminServer) setShuttingDown() {
+	atomic.StoreInt32(&a.shuttingDown, 1)
+}
+
+func (a *adminServer) handler(enablePprof bool) http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.healthz)
+	mux.HandleFunc("/readyz", a.readyz)
+	mux.HandleFunc("/debug/githooks", a.gitHooks)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// healthz fails when the leader can't renew its Lease
+func (a *adminServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if a.watchdog != nil {
+		if err := a.watchdog.Check(r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write([]byte("ok"))
+}
+
+// readyz is ready once the informers are synced, on every replica as they all
+// serve the webhook, until the shutdown starts
+func (a *adminServer) readyz(w http.ResponseWriter, r *http.Request) {
+
+	status := readiness{
+		InformersSynced: a.controller.HasSynced(),
+		Leader:          atomic.LoadInt32(&a.leader) == 1,
+		ShuttingDown:    atomic.LoadInt32(&a.shuttingDown) == 1,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.InformersSynced || status.ShuttingDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// gitHooks returns the GitHooks of the informer cache
+func (a *adminServer) gitHooks(w http.ResponseWriter, r *http.Request) {
+
+	ghs := a.controller.GetGitHooks()
+	sort.Slice(ghs, func(i, j int) bool {
+		if ghs[i].Namespace != ghs[j].Namespace {
+			return ghs[i].Namespace < ghs[j].Namespace
+		}
+		return ghs[i].Name < ghs[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ghs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// podIdentity is the name of the pod of this replica, or its hostname out of
+// cluster
+func podIdentity() string {
+	id := os.Getenv("POD_NAME")
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			klog.Fatalf("Error getting hostname: %s", err.Error())
+		}
+		id = hostname
+	}
+	return id
+}
+
+// podNamespace is the namespace of the pod of this replica, or default out of
+// cluster
+func podNamespace() string {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "default"
+	}
+	return namespace
+}
+
+// runLeaderElection blocks acquiring the Lease and calls run once this replica
+// is the leader. The process exits when the Lease is lost so the workers never
+// run on two replicas. Cancelling ctx releases the Lease and returns, so
+// another replica takes over without waiting for the Lease to expire.
+func runLeaderElection(ctx context.Context, clientset kubernetes.Interface, namespace string, name string, watchdog *leaderelection.HealthzAdaptor, run func(ctx context.Context)) {
+
+	id := podIdentity()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+
+	klog.Infof("Waiting for leader election Lease %s/%s as %s", namespace, name, id)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		WatchDog:        watchdog,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Leading with Lease %s/%s", namespace, name)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					klog.Infof("Released leader election Lease %s/%s", namespace, name)
+					return
+				}
+				klog.Fatalf("Lost leader election Lease %s/%s", namespace, name)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					klog.Infof("Leader is %s", identity)
+				}
+			},
+		},
+	})
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"net/http"
 	"flag"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"fmt"
 	"k8s.io/klog"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
 	ghclient "github.com/appspero/kube-git/pkg/client/clientset/versioned"
 	wfclient "github.com/argoproj/argo/pkg/client/clientset/versioned"
+	"github.com/appspero/kube-git/pkg/admission"
 	"github.com/appspero/kube-git/pkg/webhook"
 	"github.com/appspero/kube-git/pkg/controller"
 	"github.com/appspero/kube-git/pkg/notification"
+	"github.com/appspero/kube-git/pkg/git"
 )
 
 var (
@@ -22,6 +33,31 @@ var (
 	webhookPort             = flag.Int("webhook-port", 8080, "Service port of the webhook server.")
 	githubWebhookSecret     = flag.String("github-webhook-secret", "", "Secret of the GitHub to be used with webhook server.")
 	notificationConfigFile  = flag.String("notification-config-file", "/etc/kube-git/notification.yaml", "File containing the metadata configuration.")
+	repositoryCacheDir      = flag.String("repository-cache-dir", "", "Directory (e.g. a PVC or an emptyDir) to keep bare mirrors of the repositories in. If empty, repositories are fetched on every push.")
+	repositoryCacheSize     = flag.Int64("repository-cache-size", 0, "Maximum size in MB of the repository cache, least recently used repositories are evicted above it. 0 is unlimited.")
+	repositoryCacheMaxRepos = flag.Int("repository-cache-max-repositories", 0, "Maximum number of repositories in the repository cache. 0 is unlimited.")
+	knownHostsFile          = flag.String("known-hosts-file", "", "known_hosts file used to verify the SSH host keys of all repositories. GitHooks can add known hosts with knownHostsSecret or knownHostsConfigMap.")
+	leaderElect             = flag.Bool("leader-elect", true, "Run the controller workers only on the replica holding the leader election Lease. The webhook server runs on all replicas.")
+	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace of the leader election Lease. Default is the namespace of the pod (POD_NAMESPACE) or default.")
+	leaderElectionID        = flag.String("leader-election-id", "kube-git", "Name of the leader election Lease.")
+	webhookWorkers          = flag.Int("webhook-workers", 4, "Number of workers fetching and applying the manifests of the pushes received by the webhook.")
+	eventStoreConfigMap     = flag.String("event-store-configmap", "kube-git-events", "ConfigMap in the namespace of the pod persisting the pushes not applied yet, so they are applied after a restart. If empty, the pushes are only queued in memory.")
+	deliveryCacheTTL        = flag.Duration("delivery-cache-ttl", time.Hour, "Time to remember the webhook deliveries, the redeliveries of a push (same X-GitHub-Delivery or same repository, ref and commit) are skipped. 0 disables the detection of duplicates.")
+	deliveryCacheSize       = flag.Int("delivery-cache-size", 2000, "Maximum number of webhook deliveries remembered, the oldest are forgotten above it. The delivery store only persists the newest deliveries that fit in its ConfigMap (900KiB).")
+	deliveryStoreConfigMap  = flag.String("delivery-store-configmap", "", "ConfigMap in the namespace of the pod persisting the webhook deliveries, so the duplicates are detected after a restart and across the replicas. If empty, the deliveries are only remembered in memory.")
+	namespaces              = flag.String("namespaces", "", "Comma separated namespaces of the GitHooks and of the resources they create to watch. All the namespaces are watched if empty, which requires a ClusterRole.")
+	labelSelector           = flag.String("label-selector", "", "Label selector of the Jobs, Workflows and Tekton runs to watch for the notifications and history limits, eg. kubegit.appspero.com/githook-uid to only watch the resources created by kube-git. All are watched if empty.")
+	allowedNamespaces       = flag.String("allowed-namespaces", "", "Comma separated namespaces the manifests may create resources in besides the namespace of their GitHook, \"*\" for any namespace. None if empty.")
+	allowedKinds            = flag.String("allowed-kinds", "", "Comma separated kinds (Job, Workflow, PipelineRun, TaskRun) the manifests may create. Any supported kind if empty.")
+	admissionPort           = flag.Int("admission-port", 0, "HTTPS port of the validating and mutating admission webhooks of the GitHooks at /validate-githook and /default-githook, and of the conversion webhook of the CRD at /convert. Disabled if 0.")
+	admissionCertSecret     = flag.String("admission-cert-secret", "", "Secret in the namespace of the pod keeping a self-signed certificate of the admission webhooks, generated by the controller, which injects its CA in the caBundle of the GitHook CRD and of the kube-git webhook configurations. If empty, the certificate is read from -tls-cert-file and -tls-private-key-file.")
+	admissionService        = flag.String("admission-service", "kube-git-admission", "Service of the admission webhooks in the namespace of the pod, the self-signed certificate of -admission-cert-secret is valid for its DNS names.")
+	tlsCertFile             = flag.String("tls-cert-file", "/etc/kube-git/tls/tls.crt", "Certificate of the admission webhooks.")
+	tlsPrivateKeyFile       = flag.String("tls-private-key-file", "/etc/kube-git/tls/tls.key", "Private key of the admission webhooks.")
+	adminPort               = flag.Int("admin-port", 8081, "Port of the /healthz, /readyz, /metrics and /debug endpoints.")
+	enablePprof             = flag.Bool("enable-pprof", false, "Serve the pprof profiles at /debug/pprof on the admin port.")
+	shutdownDelay           = flag.Duration("shutdown-delay", 5*time.Second, "Time to keep serving the webhook requests on SIGTERM once the pod isn't ready anymore, so it is removed from the Service endpoints before the webhook server stops.")
+	shutdownTimeout         = flag.Duration("shutdown-timeout", 30*time.Second, "Time to wait on SIGTERM for the webhook requests, the GitHooks being applied and the queued notifications before exiting.")
 )
 
 func init() {
@@ -80,19 +116,180 @@ func main() {
 		klog.Fatalf("Error building GitHook clientset: %s", err.Error())
 	}
 
+	dynClientset, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building dynamic clientset: %s", err.Error())
+	}
+
 
   stopCh := make(chan struct{})
-  controller := controller.NewController(clientset, wfClientset, ghClientset, notificationConfig)
-	if err = controller.Run(2, stopCh); err != nil {
+	if _, err := labels.Parse(*labelSelector); err != nil {
+		klog.Fatalf("Error parsing label selector: %s", err.Error())
+	}
+
+  controller := controller.NewController(clientset, wfClientset, ghClientset, dynClientset, notificationConfig, splitList(*namespaces), *labelSelector)
+
+	admin := &adminServer{controller: controller}
+	if *leaderElect {
+		admin.watchdog = leaderelection.NewLeaderHealthzAdaptor(renewDeadline)
+	} else {
+		admin.setLeader(true)
+	}
+	adminSrv := &http.Server{Addr: fmt.Sprintf(":%d", *adminPort), Handler: admin.handler(*enablePprof)}
+	adminErr := make(chan error, 1)
+	go func() {
+		klog.Infof("Starting kube-git admin server at port: %d", *adminPort)
+		adminErr <- adminSrv.ListenAndServe()
+	}()
+
+	if err = controller.Start(stopCh); err != nil {
 		klog.Fatalf("Error running controller: %s", err.Error())
 	}
 
-	handler := webhook.NewWebhookHandler(controller, clientset, wfClientset, ghClientset, *githubWebhookSecret)
+	leaderCtx, releaseLease := context.WithCancel(context.Background())
+	leaseReleased := make(chan struct{})
+	if *leaderElect {
+		namespace := *leaderElectionNamespace
+		if namespace == "" {
+			namespace = podNamespace()
+		}
+		go func() {
+			defer close(leaseReleased)
+			runLeaderElection(leaderCtx, clientset, namespace, *leaderElectionID, admin.watchdog, func(ctx context.Context) {
+				admin.setLeader(true)
+				controller.Run(2, ctx.Done())
+				<-ctx.Done()
+				admin.setLeader(false)
+			})
+		}()
+	} else {
+		close(leaseReleased)
+		controller.Run(2, stopCh)
+	}
+
+	var repositoryCache *git.RepositoryCache
+	if *repositoryCacheDir != "" {
+		repositoryCache, err = git.NewRepositoryCache(*repositoryCacheDir, *repositoryCacheSize*1024*1024, *repositoryCacheMaxRepos)
+		if err != nil {
+			klog.Fatalf("Error creating repository cache: %s", err.Error())
+		}
+	}
+
+	var eventStore *webhook.EventStore
+	if *eventStoreConfigMap != "" {
+		eventStore = webhook.NewEventStore(clientset, podNamespace(), *eventStoreConfigMap, podIdentity())
+	}
+
+	locks := webhook.NewBranchLocks(clientset, podNamespace(), podIdentity())
+
+	var deliveries *webhook.DeliveryCache
+	if *deliveryCacheTTL > 0 {
+		var deliveryStore *webhook.DeliveryStore
+		if *deliveryStoreConfigMap != "" {
+			deliveryStore = webhook.NewDeliveryStore(clientset, podNamespace(), *deliveryStoreConfigMap)
+		}
+		deliveries = webhook.NewDeliveryCache(*deliveryCacheTTL, *deliveryCacheSize, deliveryStore)
+	}
+
+	policy := webhook.Policy{Namespaces: splitList(*allowedNamespaces), Kinds: splitList(*allowedKinds)}
+
+	handler := webhook.NewWebhookHandler(controller, clientset, wfClientset, ghClientset, dynClientset, cfg, policy, notificationConfig, repositoryCache, *knownHostsFile, eventStore, locks, deliveries, *githubWebhookSecret)
+	if err = handler.Run(*webhookWorkers); err != nil {
+		klog.Fatalf("Error recovering the pushes of the event store: %s", err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/github", handler.GithubWebhook)
+
+	server := &http.Server{Addr: fmt.Sprintf(":%d", *webhookPort), Handler: mux}
 
-	http.HandleFunc("/github", handler.GithubWebhook)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 
-	port := fmt.Sprintf(":%d", *webhookPort)
+	serverErr := make(chan error, 1)
+	go func() {
+		klog.Infof("Starting kube-git webhook at port: %d", *webhookPort)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var admissionSrv *http.Server
+	admissionErr := make(chan error, 1)
+	if *admissionPort != 0 {
+		admissionHandler := admission.NewHandler(notificationConfig)
+		admissionMux := http.NewServeMux()
+		admissionMux.HandleFunc("/validate-githook", admissionHandler.Validate)
+		admissionMux.HandleFunc("/default-githook", admissionHandler.Default)
+		admissionMux.HandleFunc("/convert", admission.Convert)
+		admissionSrv = &http.Server{Addr: fmt.Sprintf(":%d", *admissionPort), Handler: admissionMux}
+		certFile, keyFile := *tlsCertFile, *tlsPrivateKeyFile
+		if *admissionCertSecret != "" {
+			cert := admission.NewSelfSignedCert(clientset, dynClientset, podNamespace(), *admissionCertSecret, *admissionService)
+			if err := cert.Sync(); err != nil {
+				klog.Fatalf("Error creating the certificate of the admission webhooks: %s", err.Error())
+			}
+			cert.Run(stopCh)
+			admissionSrv.TLSConfig = &tls.Config{GetCertificate: cert.GetCertificate}
+			certFile, keyFile = "", ""
+		}
+		go func() {
+			klog.Infof("Starting kube-git admission webhooks at port: %d", *admissionPort)
+			admissionErr <- admissionSrv.ListenAndServeTLS(certFile, keyFile)
+		}()
+	}
 
-	klog.Infof("Starting kube-git webhook at port: %d", *webhookPort)
-	klog.Fatal(http.ListenAndServe(port, nil))
+	select {
+	case err := <-serverErr:
+		klog.Fatal(err)
+	case err := <-adminErr:
+		klog.Fatal(err)
+	case err := <-admissionErr:
+		klog.Fatal(err)
+	case sig := <-signals:
+		klog.Infof("Received %s, shutting down", sig)
+	}
+
+	// not ready anymore, so the pod is removed from the Service endpoints, and
+	// keep serving the requests sent until the endpoints are updated
+	admin.setShuttingDown()
+	time.Sleep(*shutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	// stop receiving pushes, then wait for the pushes being applied
+	if err := server.Shutdown(ctx); err != nil {
+		klog.Errorf("Error shutting down webhook server: %s", err.Error())
+	}
+	if err := handler.Wait(ctx); err != nil {
+		klog.Errorf("Error waiting for the pushes being applied: %s", err.Error())
+	}
+	// notify the queued resources, then stop the informers and release the Lease
+	if err := controller.Shutdown(ctx); err != nil {
+		klog.Errorf("Error shutting down controller: %s", err.Error())
+	}
+	close(stopCh)
+	releaseLease()
+	select {
+	case <-leaseReleased:
+	case <-ctx.Done():
+	}
+
+	adminSrv.Close()
+	if admissionSrv != nil {
+		admissionSrv.Close()
+	}
+
+	klog.Info("Shutdown complete")
+	klog.Flush()
+}
+
+// splitList splits the comma separated values of a flag
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
@@ -27,6 +27,31 @@ CODEGEN_PKG=${CODEGEN_PKG:-$(cd ${SCRIPT_ROOT}; ls -d -1 ./vendor/k8s.io/code-ge
 #                  instead of the $GOPATH directly. For normal projects this can be dropped.
 ${CODEGEN_PKG}/generate-groups.sh "deepcopy,client,informer,lister" \
   github.com/appspero/kube-git/pkg/client github.com/appspero/kube-git/pkg/apis \
-  githook:v1alpha1 \
+  githook:v1alpha1,v1beta1 \
   --output-base "$(dirname ${BASH_SOURCE})" \
   --go-header-file "${SCRIPT_ROOT}"/hack/boilerplate.go.txt
+
+# generate the CRD from the markers of the API types with controller-gen, eg.
+# installed with: go install sigs.k8s.io/controller-tools/cmd/controller-gen@v0.18.0
+# The conversion webhook is patched in by install/kustomization.yaml
+CONTROLLER_GEN=${CONTROLLER_GEN:-controller-gen}
+(cd "${SCRIPT_ROOT}" && GOFLAGS=-mod=vendor ${CONTROLLER_GEN} crd:crdVersions=v1 paths=./pkg/apis/... output:crd:stdout > install/crd.yaml.tmp)
+
+# exactly one of manifest and manifestFrom must be set, controller-gen has no
+# marker for oneOf. v1alpha1 always serializes manifest, so it must not be empty
+awk '
+  { print }
+  /^            description: GitHookSpec is the spec for a GitHook resource$/ {
+    print "            oneOf:"
+    print "            - properties:"
+    print "                manifest:"
+    print "                  minLength: 1"
+    print "              required:"
+    print "              - manifest"
+    print "            - required:"
+    print "              - manifestFrom"
+    n++
+  }
+  END { if (n != 2) { print "oneOf not added to the 2 versions of the CRD" > "/dev/stderr"; exit 1 } }
+' "${SCRIPT_ROOT}"/install/crd.yaml.tmp > "${SCRIPT_ROOT}"/install/crd.yaml
+rm "${SCRIPT_ROOT}"/install/crd.yaml.tmp
@@ -0,0 +1,129 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/notification"
+)
+
+// Handler serves the validating and mutating admission webhooks of the GitHooks
+type Handler struct {
+	notificationConfig *notification.Config
+}
+
+func NewHandler(notificationConfig *notification.Config) *Handler {
+	return &Handler{notificationConfig: notificationConfig}
+}
+
+// Validate rejects the GitHooks that would fail when a push is received
+func (h *Handler) Validate(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, func(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+
+		gh, old, err := decode(request)
+		if err != nil {
+			return denied(http.StatusBadRequest, err.Error())
+		}
+
+		// the controller removes the finalizer of a GitHook being deleted, and
+		// updates the metadata of GitHooks created before the webhook
+		if gh.DeletionTimestamp != nil || (old != nil && reflect.DeepEqual(old.Spec, gh.Spec)) {
+			return &admissionv1beta1.AdmissionResponse{Allowed: true}
+		}
+
+		// the namespace of a created GitHook may only be in the request
+		if gh.Namespace == "" {
+			gh.Namespace = request.Namespace
+		}
+		if errs := ValidateGitHook(gh, h.notificationConfig); len(errs) > 0 {
+			klog.Infof("Rejecting GitHook %s/%s: %s", request.Namespace, gh.Name, errs.ToAggregate())
+			return denied(http.StatusUnprocessableEntity, fmt.Sprintf("GitHook %s is invalid: %s", gh.Name, errs.ToAggregate()))
+		}
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	})
+}
+
+// Default sets the defaults of the GitHooks
+func (h *Handler) Default(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, func(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+
+		gh, _, err := decode(request)
+		if err != nil {
+			return denied(http.StatusBadRequest, err.Error())
+		}
+
+		response := &admissionv1beta1.AdmissionResponse{Allowed: true}
+		if patch := defaultGitHook(gh); len(patch) > 0 {
+			data, err := json.Marshal(patch)
+			if err != nil {
+				return denied(http.StatusInternalServerError, err.Error())
+			}
+			patchType := admissionv1beta1.PatchTypeJSONPatch
+			response.Patch = data
+			response.PatchType = &patchType
+		}
+		return response
+	})
+}
+
+// serve decodes the AdmissionReview of the request and writes the response of
+// admit to it
+func serve(w http.ResponseWriter, r *http.Request, admit func(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1beta1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := admit(review.Request)
+	response.UID = review.Request.UID
+	review.Response = response
+	review.Request = nil
+
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// decode returns the GitHook of a request, and the old GitHook of an update
+func decode(request *admissionv1beta1.AdmissionRequest) (*ghapi.GitHook, *ghapi.GitHook, error) {
+
+	var gh ghapi.GitHook
+	if err := json.Unmarshal(request.Object.Raw, &gh); err != nil {
+		return nil, nil, fmt.Errorf("decoding GitHook: %s", err)
+	}
+	if len(request.OldObject.Raw) == 0 {
+		return &gh, nil, nil
+	}
+	var old ghapi.GitHook
+	if err := json.Unmarshal(request.OldObject.Raw, &old); err != nil {
+		return nil, nil, fmt.Errorf("decoding old GitHook: %s", err)
+	}
+	return &gh, &old, nil
+}
+
+func denied(code int32, message string) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result:  &metav1.Status{Status: metav1.StatusFailure, Code: code, Message: message},
+	}
+}
@@ -0,0 +1,254 @@
+package admission
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog"
+)
+
+const (
+	// the self-signed certificates are valid for a year, and renewed this long
+	// before they expire
+	certRenewBefore = 30 * 24 * time.Hour
+	certSyncPeriod  = time.Hour
+
+	// caCertKey is the key of the CA certificate in the Secret
+	caCertKey = "ca.crt"
+
+	// crdName and webhookConfigurationName have the caBundle of the webhooks
+	crdName                  = "githooks.kubegit.appspero.com"
+	webhookConfigurationName = "kube-git"
+)
+
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// SelfSignedCert is the certificate of the admission and conversion webhooks
+// when cert-manager isn't installed. It's kept in a Secret shared by the
+// replicas, and its CA is injected in the caBundle of the GitHook CRD and of
+// the kube-git webhook configurations.
+type SelfSignedCert struct {
+	clientset    kubernetes.Interface
+	dynClientset dynamic.Interface
+	namespace    string
+	secret       string
+	// hosts are the DNS names of the Service of the webhooks
+	hosts []string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewSelfSignedCert creates the certificate of service kept in the Secret
+// secret, both in namespace
+func NewSelfSignedCert(clientset kubernetes.Interface, dynClientset dynamic.Interface, namespace string, secret string, service string) *SelfSignedCert {
+	return &SelfSignedCert{
+		clientset:    clientset,
+		dynClientset: dynClientset,
+		namespace:    namespace,
+		secret:       secret,
+		hosts:        []string{service + "." + namespace + ".svc", service + "." + namespace + ".svc.cluster.local"},
+	}
+}
+
+// Run renews the certificate until stopCh is closed
+func (c *SelfSignedCert) Run(stopCh <-chan struct{}) {
+	go wait.Until(func() {
+		if err := c.Sync(); err != nil {
+			klog.Errorf("Error syncing the certificate of the admission webhooks: %s", err.Error())
+		}
+	}, certSyncPeriod, stopCh)
+}
+
+// GetCertificate returns the certificate of the last Sync, for tls.Config
+func (c *SelfSignedCert) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		return nil, fmt.Errorf("the certificate of the admission webhooks isn't loaded")
+	}
+	return c.cert, nil
+}
+
+// Sync creates or renews the certificate in the Secret, injects its CA and
+// loads it
+func (c *SelfSignedCert) Sync() error {
+
+	s, err := c.ensureSecret()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(s.Data[corev1.TLSCertKey], s.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return err
+	}
+	if err := c.injectCABundle(s.Data[caCertKey]); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// ensureSecret returns the Secret, creating or renewing its certificate if
+// it's missing, expiring or not valid for the hosts
+func (c *SelfSignedCert) ensureSecret() (*corev1.Secret, error) {
+
+	secrets := c.clientset.CoreV1().Secrets(c.namespace)
+	s, err := secrets.Get(c.secret, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		s = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.secret,
+				Namespace: c.namespace,
+				Labels:    map[string]string{"k8s-app": "kube-git"},
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	case err != nil:
+		return nil, err
+	case validCert(s.Data, c.hosts, time.Now()):
+		return s, nil
+	}
+
+	klog.Infof("Generating the certificate of the admission webhooks in Secret %s/%s", c.namespace, c.secret)
+	s.Data, err = generateCert(c.hosts)
+	if err != nil {
+		return nil, err
+	}
+	if s.ResourceVersion == "" {
+		s, err = secrets.Create(s)
+	} else {
+		s, err = secrets.Update(s)
+	}
+	if errors.IsAlreadyExists(err) || errors.IsConflict(err) {
+		// created or renewed by another replica
+		return secrets.Get(c.secret, metav1.GetOptions{})
+	}
+	return s, err
+}
+
+// injectCABundle sets the caBundle of the conversion webhook of the CRD and
+// of the webhooks of the kube-git webhook configurations
+func (c *SelfSignedCert) injectCABundle(ca []byte) error {
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"conversion": map[string]interface{}{
+				"webhook": map[string]interface{}{
+					"clientConfig": map[string]interface{}{"caBundle": ca},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.dynClientset.Resource(crdResource).Patch(crdName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error injecting the CA in CustomResourceDefinition %s: %s", crdName, err)
+	}
+
+	// the admission webhooks are optional
+	mutating := c.clientset.AdmissionregistrationV1beta1().MutatingWebhookConfigurations()
+	if config, err := mutating.Get(webhookConfigurationName, metav1.GetOptions{}); err == nil {
+		changed := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, ca) {
+				config.Webhooks[i].ClientConfig.CABundle = ca
+				changed = true
+			}
+		}
+		if changed {
+			if _, err := mutating.Update(config); err != nil {
+				return fmt.Errorf("error injecting the CA in MutatingWebhookConfiguration %s: %s", webhookConfigurationName, err)
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	validating := c.clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+	if config, err := validating.Get(webhookConfigurationName, metav1.GetOptions{}); err == nil {
+		changed := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, ca) {
+				config.Webhooks[i].ClientConfig.CABundle = ca
+				changed = true
+			}
+		}
+		if changed {
+			if _, err := validating.Update(config); err != nil {
+				return fmt.Errorf("error injecting the CA in ValidatingWebhookConfiguration %s: %s", webhookConfigurationName, err)
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// validCert returns whether the certificate of the Secret data is valid for
+// the hosts and doesn't expire soon after now
+func validCert(data map[string][]byte, hosts []string, now time.Time) bool {
+
+	if len(data[caCertKey]) == 0 || len(data[corev1.TLSPrivateKeyKey]) == 0 {
+		return false
+	}
+	block, _ := pem.Decode(data[corev1.TLSCertKey])
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || now.Add(certRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generateCert returns the Secret data of a new certificate of the hosts,
+// signed by a new CA
+func generateCert(hosts []string) (map[string][]byte, error) {
+
+	// the certificate is followed by its CA
+	chain, key, err := certutil.GenerateSelfSignedCertKey(hosts[0], nil, hosts[1:])
+	if err != nil {
+		return nil, err
+	}
+	var ca []byte
+	for rest := chain; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		ca = pem.EncodeToMemory(block)
+	}
+	return map[string][]byte{
+		corev1.TLSCertKey:       chain,
+		corev1.TLSPrivateKeyKey: key,
+		caCertKey:               ca,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package admission
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": crdName},
+		"spec": map[string]interface{}{
+			"conversion": map[string]interface{}{"strategy": "Webhook"},
+		},
+	}}
+	dynClientset := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), crd)
+	clientset := fake.NewSimpleClientset(&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookConfigurationName},
+		Webhooks:   []admissionregistrationv1beta1.ValidatingWebhook{{Name: "validate.githooks.kubegit.appspero.com"}},
+	})
+
+	c := NewSelfSignedCert(clientset, dynClientset, "kube-git", "kube-git-admission-tls", "kube-git-admission")
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := clientset.CoreV1().Secrets("kube-git").Get("kube-git-admission-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := s.Data[caCertKey]
+
+	// the certificate is served and verified by its CA for the Service
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "kube-git-admission.kube-git.svc", Roots: pool}); err != nil {
+		t.Errorf("certificate not verified by its CA: %s", err.Error())
+	}
+
+	got, err := dynClientset.Resource(crdResource).Get(crdName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, _, _ := unstructured.NestedString(got.Object, "spec", "conversion", "webhook", "clientConfig", "caBundle")
+	if bundle != base64.StdEncoding.EncodeToString(ca) {
+		t.Errorf("got CRD caBundle %q, want the CA of the Secret", bundle)
+	}
+	config, err := clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(webhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(config.Webhooks[0].ClientConfig.CABundle, ca) {
+		t.Errorf("got webhook caBundle %q, want the CA of the Secret", config.Webhooks[0].ClientConfig.CABundle)
+	}
+
+	// another replica keeps the certificate of the Secret
+	other := NewSelfSignedCert(clientset, dynClientset, "kube-git", "kube-git-admission-tls", "kube-git-admission")
+	if err := other.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	otherCert, _ := other.GetCertificate(nil)
+	if !bytes.Equal(otherCert.Certificate[0], cert.Certificate[0]) {
+		t.Errorf("another replica generated another certificate")
+	}
+}
+
+func TestValidCert(t *testing.T) {
+
+	hosts := []string{"kube-git-admission.kube-git.svc", "kube-git-admission.kube-git.svc.cluster.local"}
+	data, err := generateCert(hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		hosts []string
+		now   time.Time
+		want  bool
+	}{
+		{name: "valid", hosts: hosts, now: time.Now(), want: true},
+		{name: "expiring", hosts: hosts, now: time.Now().Add(365*24*time.Hour - certRenewBefore)},
+		{name: "other namespace", hosts: []string{"kube-git-admission.default.svc"}, now: time.Now()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := validCert(data, test.hosts, test.now); got != test.want {
+				t.Errorf("got valid %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/apis/githook/v1alpha1"
+	"github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// conversionReview is the apiextensions.k8s.io/v1beta1 ConversionReview sent to
+// the conversion webhook, k8s.io/apiextensions-apiserver isn't vendored
+type conversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *conversionRequest  `json:"request,omitempty"`
+	Response        *conversionResponse `json:"response,omitempty"`
+}
+
+type conversionRequest struct {
+	UID               types.UID              `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID              types.UID              `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+// Convert is the conversion webhook of the GitHook CRD, converting GitHooks
+// between v1alpha1 and v1beta1
+func Convert(w http.ResponseWriter, r *http.Request) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var review conversionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid ConversionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := &conversionResponse{
+		UID:    review.Request.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+	for _, obj := range review.Request.Objects {
+		converted, err := convertGitHook(obj.Raw, review.Request.DesiredAPIVersion)
+		if err != nil {
+			klog.Errorf("Error converting GitHook to %s: %s", review.Request.DesiredAPIVersion, err.Error())
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			break
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+
+	review.Request = nil
+	review.Response = response
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// convertGitHook converts a GitHook to apiVersion
+func convertGitHook(raw []byte, apiVersion string) ([]byte, error) {
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.APIVersion == apiVersion {
+		return raw, nil
+	}
+
+	alpha1, beta1 := v1alpha1.SchemeGroupVersion.String(), v1beta1.SchemeGroupVersion.String()
+	switch {
+	case typeMeta.APIVersion == alpha1 && apiVersion == beta1:
+		var src v1alpha1.GitHook
+		if err := json.Unmarshal(raw, &src); err != nil {
+			return nil, err
+		}
+		var dst v1beta1.GitHook
+		if err := src.ConvertTo(&dst); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&dst)
+
+	case typeMeta.APIVersion == beta1 && apiVersion == alpha1:
+		var src v1beta1.GitHook
+		if err := json.Unmarshal(raw, &src); err != nil {
+			return nil, err
+		}
+		var dst v1alpha1.GitHook
+		if err := dst.ConvertFrom(&src); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&dst)
+	}
+
+	return nil, fmt.Errorf("unsupported conversion from %s to %s", typeMeta.APIVersion, apiVersion)
+}
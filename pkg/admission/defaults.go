@@ -0,0 +1,66 @@
+package admission
+
+import (
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// patchOperation is a JSON patch operation of the mutating webhook
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// defaultGitHook returns the JSON patch setting the defaults of the spec of a
+// GitHook
+func defaultGitHook(gh *ghapi.GitHook) []patchOperation {
+
+	var patch []patchOperation
+	spec := &gh.Spec
+
+	set := func(path string, value interface{}) {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/" + path, Value: value})
+	}
+
+	if spec.ConcurrencyPolicy == "" {
+		set("concurrencyPolicy", ghapi.AllowConcurrent)
+	}
+	if spec.CleanupPolicy == "" {
+		set("cleanupPolicy", ghapi.OrphanResources)
+	}
+	if spec.ContentAPI != nil && spec.ContentAPI.Provider == "github" && spec.ContentAPI.URL == "" {
+		set("contentAPI/url", "https://api.github.com")
+	}
+
+	// the keys of the kubernetes.io/basic-auth and ssh-auth Secrets
+	type keyRef struct {
+		path       string
+		name, key  string
+		defaultKey string
+	}
+	var refs []keyRef
+	if basic := spec.Auth.Basic; basic != nil {
+		refs = append(refs,
+			keyRef{"auth/basic/usernameSecret", basic.UsernameSecret.Name, basic.UsernameSecret.Key, "username"},
+			keyRef{"auth/basic/passwordSecret", basic.PasswordSecret.Name, basic.PasswordSecret.Key, "password"})
+	}
+	if ssh := spec.Auth.SSH; ssh != nil {
+		refs = append(refs, keyRef{"auth/ssh/privateKeySecret", ssh.PrivateKeySecret.Name, ssh.PrivateKeySecret.Key, "ssh-privatekey"})
+		if ssh.PassphraseSecret != nil {
+			refs = append(refs, keyRef{"auth/ssh/passphraseSecret", ssh.PassphraseSecret.Name, ssh.PassphraseSecret.Key, "passphrase"})
+		}
+		if ssh.KnownHostsSecret != nil {
+			refs = append(refs, keyRef{"auth/ssh/knownHostsSecret", ssh.KnownHostsSecret.Name, ssh.KnownHostsSecret.Key, "known_hosts"})
+		}
+		if ssh.KnownHostsConfigMap != nil {
+			refs = append(refs, keyRef{"auth/ssh/knownHostsConfigMap", ssh.KnownHostsConfigMap.Name, ssh.KnownHostsConfigMap.Key, "known_hosts"})
+		}
+	}
+	for _, ref := range refs {
+		if ref.name != "" && ref.key == "" {
+			set(ref.path+"/key", ref.defaultKey)
+		}
+	}
+
+	return patch
+}
@@ -0,0 +1,268 @@
+package admission
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/notification"
+)
+
+// supportedKinds are the kinds of resources a manifest can create
+var supportedKinds = []string{"Job", "Workflow", "PipelineRun", "TaskRun"}
+
+// ValidateGitHook checks the spec of a GitHook and the notification configs
+// and GitHub Apps it refers to in the notification config of the controller
+func ValidateGitHook(gh *ghapi.GitHook, config *notification.Config) field.ErrorList {
+
+	var errs field.ErrorList
+	spec := &gh.Spec
+	path := field.NewPath("spec")
+
+	if spec.Repository == "" {
+		errs = append(errs, field.Required(path.Child("repository"), ""))
+	}
+
+	if len(spec.Branches) == 0 {
+		errs = append(errs, field.Required(path.Child("branches"), "no push would match"))
+	}
+	for i, branch := range spec.Branches {
+		if msg := validateBranchPattern(branch); msg != "" {
+			errs = append(errs, field.Invalid(path.Child("branches").Index(i), branch, msg))
+		}
+	}
+
+	errs = append(errs, validateManifest(spec, path)...)
+	errs = append(errs, validateAuth(spec, gh.Namespace, path, config)...)
+
+	if spec.ContentAPI != nil && spec.ContentAPI.Provider != "github" {
+		errs = append(errs, field.NotSupported(path.Child("contentAPI", "provider"), spec.ContentAPI.Provider, []string{"github"}))
+	}
+
+	if spec.ServiceAccountName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.ServiceAccountName) {
+			errs = append(errs, field.Invalid(path.Child("serviceAccountName"), spec.ServiceAccountName, msg))
+		}
+	}
+	for i, namespace := range spec.AllowedNamespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, field.Invalid(path.Child("allowedNamespaces").Index(i), namespace, msg))
+		}
+	}
+	for i, kind := range spec.AllowedKinds {
+		if !contains(supportedKinds, kind) {
+			errs = append(errs, field.NotSupported(path.Child("allowedKinds").Index(i), kind, supportedKinds))
+		}
+	}
+
+	switch spec.ConcurrencyPolicy {
+	case "", ghapi.AllowConcurrent, ghapi.ForbidConcurrent, ghapi.ReplaceConcurrent, ghapi.QueueConcurrent:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("concurrencyPolicy"), spec.ConcurrencyPolicy,
+			[]string{string(ghapi.AllowConcurrent), string(ghapi.ForbidConcurrent), string(ghapi.ReplaceConcurrent), string(ghapi.QueueConcurrent)}))
+	}
+	switch spec.CleanupPolicy {
+	case "", ghapi.OrphanResources, ghapi.DeleteResources:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("cleanupPolicy"), spec.CleanupPolicy,
+			[]string{string(ghapi.OrphanResources), string(ghapi.DeleteResources)}))
+	}
+
+	if spec.SuccessfulRunsHistoryLimit != nil && *spec.SuccessfulRunsHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(path.Child("successfulRunsHistoryLimit"), *spec.SuccessfulRunsHistoryLimit, "must be greater than or equal to 0"))
+	}
+	if spec.FailedRunsHistoryLimit != nil && *spec.FailedRunsHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(path.Child("failedRunsHistoryLimit"), *spec.FailedRunsHistoryLimit, "must be greater than or equal to 0"))
+	}
+
+	if sv := spec.SignatureVerification; sv != nil && sv.Secret == "" && sv.ConfigMap == "" {
+		errs = append(errs, field.Required(path.Child("signatureVerification"), "secret or configMap is required"))
+	}
+
+	for i, n := range spec.Notifications {
+		notificationPath := path.Child("notifications").Index(i)
+		found := true
+		switch n.Provider {
+		case ghapi.GithubNotification:
+			if config != nil {
+				_, found = config.Github[n.Name]
+			}
+		case ghapi.SlackNotification:
+			if config != nil {
+				_, found = config.Slack[n.Name]
+			}
+		default:
+			errs = append(errs, field.NotSupported(notificationPath.Child("provider"), n.Provider, []string{ghapi.GithubNotification, ghapi.SlackNotification}))
+		}
+		if !found {
+			errs = append(errs, field.NotFound(notificationPath.Child("name"), n.Name))
+		}
+	}
+
+	for i, p := range spec.Parameters {
+		parameterPath := path.Child("parameters").Index(i)
+		if p.Name == "" {
+			errs = append(errs, field.Required(parameterPath.Child("name"), ""))
+		}
+		if p.Value != ghapi.RevisionValue && p.Value != ghapi.BranchValue {
+			errs = append(errs, field.NotSupported(parameterPath.Child("value"), p.Value, []string{string(ghapi.RevisionValue), string(ghapi.BranchValue)}))
+		}
+	}
+
+	return errs
+}
+
+// validateManifest checks that the manifest is read from the repository, or
+// from exactly one of manifestFrom
+func validateManifest(spec *ghapi.GitHookSpec, path *field.Path) field.ErrorList {
+
+	var errs field.ErrorList
+
+	if spec.ManifestFrom == nil {
+		if spec.Manifest == "" {
+			errs = append(errs, field.Required(path.Child("manifest"), "manifest or manifestFrom is required"))
+		}
+		return errs
+	}
+
+	fromPath := path.Child("manifestFrom")
+	from := spec.ManifestFrom
+	switch {
+	case from.Inline == nil && from.ConfigMap == nil:
+		errs = append(errs, field.Required(fromPath, "inline or configMap is required"))
+	case from.Inline != nil && from.ConfigMap != nil:
+		errs = append(errs, field.Forbidden(fromPath, "only one of inline or configMap may be set"))
+	case from.ConfigMap != nil:
+		errs = append(errs, validateSelector(from.ConfigMap.Name, from.ConfigMap.Key, fromPath.Child("configMap"))...)
+	}
+	return errs
+}
+
+// validateAuth checks the credentials of the repository, only one of basic
+// auth, SSH auth or a GitHub App may be set
+func validateAuth(spec *ghapi.GitHookSpec, namespace string, path *field.Path, config *notification.Config) field.ErrorList {
+
+	var errs field.ErrorList
+	auth := spec.Auth
+	authPath := path.Child("auth")
+
+	set := 0
+	if auth.Basic != nil {
+		set++
+		basicPath := authPath.Child("basic")
+		errs = append(errs, validateRequiredSelector(auth.Basic.UsernameSecret.Name, auth.Basic.UsernameSecret.Key, basicPath.Child("usernameSecret"))...)
+		errs = append(errs, validateRequiredSelector(auth.Basic.PasswordSecret.Name, auth.Basic.PasswordSecret.Key, basicPath.Child("passwordSecret"))...)
+	}
+	if ssh := auth.SSH; ssh != nil {
+		set++
+		sshPath := authPath.Child("ssh")
+		errs = append(errs, validateRequiredSelector(ssh.PrivateKeySecret.Name, ssh.PrivateKeySecret.Key, sshPath.Child("privateKeySecret"))...)
+		if ssh.PassphraseSecret != nil {
+			errs = append(errs, validateRequiredSelector(ssh.PassphraseSecret.Name, ssh.PassphraseSecret.Key, sshPath.Child("passphraseSecret"))...)
+		}
+		if ssh.KnownHostsSecret != nil {
+			errs = append(errs, validateRequiredSelector(ssh.KnownHostsSecret.Name, ssh.KnownHostsSecret.Key, sshPath.Child("knownHostsSecret"))...)
+		}
+		if ssh.KnownHostsConfigMap != nil {
+			errs = append(errs, validateRequiredSelector(ssh.KnownHostsConfigMap.Name, ssh.KnownHostsConfigMap.Key, sshPath.Child("knownHostsConfigMap"))...)
+		}
+	}
+	if auth.GithubApp != "" {
+		set++
+		if config != nil {
+			if github, ok := config.Github[auth.GithubApp]; !ok || github.AppID == 0 {
+				errs = append(errs, field.NotFound(authPath.Child("githubApp"), auth.GithubApp))
+			} else if !github.AppAllowed(namespace) {
+				errs = append(errs, field.Forbidden(authPath.Child("githubApp"), "the GitHub App is not allowed in namespace "+namespace))
+			}
+		}
+	}
+	if set > 1 {
+		errs = append(errs, field.Forbidden(authPath, "only one of basic, ssh or githubApp may be set"))
+	}
+	return errs
+}
+
+// validateRequiredSelector checks the name and key of a Secret or ConfigMap
+// selector that must be set
+func validateRequiredSelector(name string, key string, path *field.Path) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(path.Child("name"), "")}
+	}
+	return validateSelector(name, key, path)
+}
+
+// validateSelector checks that a Secret or ConfigMap selector has both a valid
+// name and key, or none. The Secret or ConfigMap isn't read: it may be created
+// after the GitHook, and a missing key is reported when a push is applied.
+func validateSelector(name string, key string, path *field.Path) field.ErrorList {
+
+	var errs field.ErrorList
+
+	if name == "" {
+		if key != "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		}
+		return errs
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		errs = append(errs, field.Invalid(path.Child("name"), name, msg))
+	}
+	if key == "" {
+		errs = append(errs, field.Required(path.Child("key"), ""))
+	} else {
+		for _, msg := range validation.IsConfigMapKey(key) {
+			errs = append(errs, field.Invalid(path.Child("key"), key, msg))
+		}
+	}
+	return errs
+}
+
+// branchRefPrefix is the prefix of the pushed refs matched by the branches
+const branchRefPrefix = "refs/heads/"
+
+// validateBranchPattern returns why a branch pattern can never match the full
+// ref of a branch, following git check-ref-format with "*" as a wildcard
+func validateBranchPattern(pattern string) string {
+
+	if pattern == "" {
+		return "must not be empty"
+	}
+	switch wildcard := strings.Index(pattern, "*"); {
+	case strings.HasPrefix(pattern, branchRefPrefix):
+		pattern = strings.TrimPrefix(pattern, branchRefPrefix)
+		if pattern == "" {
+			return "must have a branch name after " + branchRefPrefix
+		}
+	case wildcard >= 0 && strings.HasPrefix(branchRefPrefix, pattern[:wildcard]):
+		// the wildcard matches the end of the prefix, eg. * or refs/*
+		pattern = pattern[wildcard:]
+	default:
+		return "must be the full ref of a branch, eg. " + branchRefPrefix + "main"
+	}
+	for _, c := range pattern {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?[\\", c) {
+			return "must not contain spaces, control characters or any of ~^:?[\\"
+		}
+	}
+	for _, s := range []string{"..", "@{", "//"} {
+		if strings.Contains(pattern, s) {
+			return "must not contain " + s
+		}
+	}
+	if strings.HasPrefix(pattern, "/") || strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, ".") || strings.HasSuffix(pattern, ".lock") {
+		return "must not start or end with / or end with . or .lock"
+	}
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
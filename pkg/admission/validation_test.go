@@ -0,0 +1,56 @@
+package admission
+
+import (
+	"testing"
+
+	"github.com/appspero/kube-git/pkg/webhook"
+)
+
+func TestValidateBranchPattern(t *testing.T) {
+
+	// the full refs of the pushed branches, matched by the webhook
+	refs := []string{"refs/heads/main", "refs/heads/feature/login", "refs/heads/release-1.0"}
+
+	tests := []struct {
+		pattern string
+		valid   bool
+		// a ref of refs the pattern matches if it's valid
+		match string
+	}{
+		{pattern: "refs/heads/main", valid: true, match: "refs/heads/main"},
+		{pattern: "refs/heads/*", valid: true, match: "refs/heads/main"},
+		{pattern: "refs/heads/feature/*", valid: true, match: "refs/heads/feature/login"},
+		{pattern: "refs/heads/release-*", valid: true, match: "refs/heads/release-1.0"},
+		{pattern: "refs/*", valid: true, match: "refs/heads/main"},
+		{pattern: "*", valid: true, match: "refs/heads/main"},
+		{pattern: "*/login", valid: true, match: "refs/heads/feature/login"},
+		{pattern: "main"},
+		{pattern: "feature/*"},
+		{pattern: "refs/tags/*"},
+		{pattern: "refs/heads/"},
+		{pattern: "refs/heads/ma..in"},
+		{pattern: "refs/heads/main.lock"},
+		{pattern: "refs/heads/ma in"},
+		{pattern: "refs/heads//main"},
+		{pattern: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			msg := validateBranchPattern(test.pattern)
+			if valid := msg == ""; valid != test.valid {
+				t.Fatalf("got valid %v (%s), want %v", valid, msg, test.valid)
+			}
+			if test.match != "" && !webhook.MatchBranch([]string{test.pattern}, test.match) {
+				t.Errorf("valid pattern doesn't match %s", test.match)
+			}
+			if !test.valid {
+				for _, ref := range refs {
+					if webhook.MatchBranch([]string{test.pattern}, ref) {
+						t.Errorf("invalid pattern matches %s", ref)
+					}
+				}
+			}
+		})
+	}
+}
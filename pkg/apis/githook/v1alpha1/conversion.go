@@ -0,0 +1,345 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// ConversionAnnotation keeps the parameters and notifications of a v1beta1
+// GitHook that a v1alpha1 GitHook can't hold, so they are restored when it's
+// converted back
+const ConversionAnnotation = "kubegit.appspero.com/v1beta1-conversion"
+
+// AlphaConversionAnnotation keeps the ArgoWorkflow and Tekton fields of a
+// v1alpha1 GitHook that its v1beta1 parameters don't hold, so they are
+// restored when it's converted back
+const AlphaConversionAnnotation = "kubegit.appspero.com/v1alpha1-conversion"
+
+// beta1Fields are the fields of ConversionAnnotation
+type beta1Fields struct {
+	Parameters    []v1beta1.Parameter    `json:"parameters,omitempty"`
+	Notifications []v1beta1.Notification `json:"notifications,omitempty"`
+}
+
+// alpha1Fields are the fields of AlphaConversionAnnotation
+type alpha1Fields struct {
+	ArgoWorkflow *ArgoWorkflowSpec `json:"argoWorkflow,omitempty"`
+	Tekton       *TektonSpec       `json:"tekton,omitempty"`
+}
+
+// ConvertTo converts the GitHook to v1beta1
+func (src *GitHook) ConvertTo(dst *v1beta1.GitHook) error {
+
+	dst.TypeMeta = src.TypeMeta
+	dst.APIVersion = v1beta1.SchemeGroupVersion.String()
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	in, out := &src.Spec, &dst.Spec
+	out.Repository = in.Repository
+	out.Branches = in.Branches
+	out.Manifest = in.Manifest
+	if in.ManifestFrom != nil {
+		out.ManifestFrom = &v1beta1.ManifestSource{Inline: in.ManifestFrom.Inline}
+		if in.ManifestFrom.ConfigMap != nil {
+			out.ManifestFrom.ConfigMap = &v1beta1.ConfigMapKeySelector{Name: in.ManifestFrom.ConfigMap.Name, Key: in.ManifestFrom.ConfigMap.Key}
+		}
+	}
+	out.Submodules = in.Submodules
+	out.LFS = in.LFS
+	if in.ContentAPI != nil {
+		out.ContentAPI = &v1beta1.ContentAPISpec{Provider: in.ContentAPI.Provider, URL: in.ContentAPI.URL}
+	}
+	out.TimestampSuffix = in.TimestampSuffix
+	out.ServiceAccountName = in.ServiceAccountName
+	out.AllowedNamespaces = in.AllowedNamespaces
+	out.AllowedKinds = in.AllowedKinds
+	out.ConcurrencyPolicy = v1beta1.ConcurrencyPolicy(in.ConcurrencyPolicy)
+	out.SuccessfulRunsHistoryLimit = in.SuccessfulRunsHistoryLimit
+	out.FailedRunsHistoryLimit = in.FailedRunsHistoryLimit
+	out.DisableOwnerReferences = in.DisableOwnerReferences
+	out.CleanupPolicy = v1beta1.CleanupPolicy(in.CleanupPolicy)
+	if in.SignatureVerification != nil {
+		out.SignatureVerification = &v1beta1.SignatureVerificationSpec{Secret: in.SignatureVerification.Secret, ConfigMap: in.SignatureVerification.ConfigMap}
+	}
+
+	if in.UsernameSecret != (Secret{}) || in.PasswordSecret != (Secret{}) {
+		out.Auth.Basic = &v1beta1.BasicAuth{
+			UsernameSecret: v1beta1.SecretKeySelector(in.UsernameSecret),
+			PasswordSecret: v1beta1.SecretKeySelector(in.PasswordSecret),
+		}
+	}
+	if in.SshPrivateKeySecret != (Secret{}) || in.SshPassphraseSecret != (Secret{}) || in.SshUser != "" ||
+		in.KnownHostsSecret != (Secret{}) || in.KnownHostsConfigMap != (ConfigMapKey{}) || in.SshInsecureIgnoreHostKey {
+		out.Auth.SSH = &v1beta1.SSHAuth{
+			PrivateKeySecret:      v1beta1.SecretKeySelector(in.SshPrivateKeySecret),
+			User:                  in.SshUser,
+			InsecureIgnoreHostKey: in.SshInsecureIgnoreHostKey,
+		}
+		if in.SshPassphraseSecret != (Secret{}) {
+			out.Auth.SSH.PassphraseSecret = &v1beta1.SecretKeySelector{Name: in.SshPassphraseSecret.Name, Key: in.SshPassphraseSecret.Key}
+		}
+		if in.KnownHostsSecret != (Secret{}) {
+			out.Auth.SSH.KnownHostsSecret = &v1beta1.SecretKeySelector{Name: in.KnownHostsSecret.Name, Key: in.KnownHostsSecret.Key}
+		}
+		if in.KnownHostsConfigMap != (ConfigMapKey{}) {
+			out.Auth.SSH.KnownHostsConfigMap = &v1beta1.ConfigMapKeySelector{Name: in.KnownHostsConfigMap.Name, Key: in.KnownHostsConfigMap.Key}
+		}
+	}
+	out.Auth.GithubApp = in.GithubApp
+
+	out.Parameters = toParameters(in)
+	out.Notifications = toNotifications(in)
+
+	// restore the fields of the v1beta1 GitHook if they weren't changed
+	if data, ok := src.Annotations[ConversionAnnotation]; ok {
+		var fields beta1Fields
+		if err := json.Unmarshal([]byte(data), &fields); err == nil {
+			var spec GitHookSpec
+			setParameters(&spec, fields.Parameters)
+			setNotifications(&spec, fields.Notifications)
+			if reflect.DeepEqual(spec.ArgoWorkflow, in.ArgoWorkflow) && reflect.DeepEqual(spec.Tekton, in.Tekton) && spec.Notification == in.Notification {
+				out.Parameters = fields.Parameters
+				out.Notifications = fields.Notifications
+			}
+		}
+		delete(dst.Annotations, ConversionAnnotation)
+	}
+
+	// keep the fields of each kind the parameters can't hold
+	var spec GitHookSpec
+	setParameters(&spec, out.Parameters)
+	if !reflect.DeepEqual(spec.ArgoWorkflow, in.ArgoWorkflow) || !reflect.DeepEqual(spec.Tekton, in.Tekton) {
+		data, err := json.Marshal(alpha1Fields{ArgoWorkflow: in.ArgoWorkflow, Tekton: in.Tekton})
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = make(map[string]string)
+		}
+		dst.Annotations[AlphaConversionAnnotation] = string(data)
+	} else {
+		delete(dst.Annotations, AlphaConversionAnnotation)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	convertStatus(&src.Status, &dst.Status)
+	return nil
+}
+
+// ConvertFrom converts the GitHook from v1beta1. Its parameters are set on
+// both ArgoWorkflow and Tekton, unless they are still the parameters of the
+// v1alpha1 GitHook it was converted from.
+func (dst *GitHook) ConvertFrom(src *v1beta1.GitHook) error {
+
+	dst.TypeMeta = src.TypeMeta
+	dst.APIVersion = SchemeGroupVersion.String()
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	in, out := &src.Spec, &dst.Spec
+	out.Repository = in.Repository
+	out.Branches = in.Branches
+	out.Manifest = in.Manifest
+	if in.ManifestFrom != nil {
+		out.ManifestFrom = &ManifestSource{Inline: in.ManifestFrom.Inline}
+		if in.ManifestFrom.ConfigMap != nil {
+			out.ManifestFrom.ConfigMap = &ConfigMapKey{Name: in.ManifestFrom.ConfigMap.Name, Key: in.ManifestFrom.ConfigMap.Key}
+		}
+	}
+	out.Submodules = in.Submodules
+	out.LFS = in.LFS
+	if in.ContentAPI != nil {
+		out.ContentAPI = &ContentAPISpec{Provider: in.ContentAPI.Provider, URL: in.ContentAPI.URL}
+	}
+	out.TimestampSuffix = in.TimestampSuffix
+	out.ServiceAccountName = in.ServiceAccountName
+	out.AllowedNamespaces = in.AllowedNamespaces
+	out.AllowedKinds = in.AllowedKinds
+	out.ConcurrencyPolicy = ConcurrencyPolicy(in.ConcurrencyPolicy)
+	out.SuccessfulRunsHistoryLimit = in.SuccessfulRunsHistoryLimit
+	out.FailedRunsHistoryLimit = in.FailedRunsHistoryLimit
+	out.DisableOwnerReferences = in.DisableOwnerReferences
+	out.CleanupPolicy = CleanupPolicy(in.CleanupPolicy)
+	if in.SignatureVerification != nil {
+		out.SignatureVerification = &SignatureVerificationSpec{Secret: in.SignatureVerification.Secret, ConfigMap: in.SignatureVerification.ConfigMap}
+	}
+
+	if basic := in.Auth.Basic; basic != nil {
+		out.UsernameSecret = Secret(basic.UsernameSecret)
+		out.PasswordSecret = Secret(basic.PasswordSecret)
+	}
+	if ssh := in.Auth.SSH; ssh != nil {
+		out.SshPrivateKeySecret = Secret(ssh.PrivateKeySecret)
+		out.SshUser = ssh.User
+		out.SshInsecureIgnoreHostKey = ssh.InsecureIgnoreHostKey
+		if ssh.PassphraseSecret != nil {
+			out.SshPassphraseSecret = Secret(*ssh.PassphraseSecret)
+		}
+		if ssh.KnownHostsSecret != nil {
+			out.KnownHostsSecret = Secret(*ssh.KnownHostsSecret)
+		}
+		if ssh.KnownHostsConfigMap != nil {
+			out.KnownHostsConfigMap = ConfigMapKey(*ssh.KnownHostsConfigMap)
+		}
+	}
+	out.GithubApp = in.Auth.GithubApp
+
+	setParameters(out, in.Parameters)
+	setNotifications(out, in.Notifications)
+
+	// restore the fields of the v1alpha1 GitHook if the parameters weren't changed
+	if data, ok := src.Annotations[AlphaConversionAnnotation]; ok {
+		var fields alpha1Fields
+		if err := json.Unmarshal([]byte(data), &fields); err == nil {
+			spec := GitHookSpec{ArgoWorkflow: fields.ArgoWorkflow, Tekton: fields.Tekton}
+			if sameList(toParameters(&spec), in.Parameters) {
+				out.ArgoWorkflow, out.Tekton = fields.ArgoWorkflow, fields.Tekton
+			}
+		}
+		delete(dst.Annotations, AlphaConversionAnnotation)
+	}
+
+	// keep the fields v1alpha1 can't hold
+	if !sameList(toParameters(out), in.Parameters) || !sameList(toNotifications(out), in.Notifications) {
+		data, err := json.Marshal(beta1Fields{Parameters: in.Parameters, Notifications: in.Notifications})
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = make(map[string]string)
+		}
+		dst.Annotations[ConversionAnnotation] = string(data)
+	} else {
+		delete(dst.Annotations, ConversionAnnotation)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	convertStatusFrom(&src.Status, &dst.Status)
+	return nil
+}
+
+// toParameters returns the parameters of ArgoWorkflow and Tekton
+func toParameters(spec *GitHookSpec) []v1beta1.Parameter {
+
+	var parameters []v1beta1.Parameter
+	add := func(name string, value v1beta1.ParameterValue) {
+		if name == "" {
+			return
+		}
+		p := v1beta1.Parameter{Name: name, Value: value}
+		for _, existing := range parameters {
+			if existing == p {
+				return
+			}
+		}
+		parameters = append(parameters, p)
+	}
+
+	if spec.ArgoWorkflow != nil {
+		add(spec.ArgoWorkflow.RevisionParameterName, v1beta1.RevisionValue)
+		add(spec.ArgoWorkflow.BranchParameterName, v1beta1.BranchValue)
+	}
+	if spec.Tekton != nil {
+		add(spec.Tekton.RevisionParameterName, v1beta1.RevisionValue)
+		add(spec.Tekton.BranchParameterName, v1beta1.BranchValue)
+	}
+	return parameters
+}
+
+// setParameters sets ArgoWorkflow and Tekton to the first revision and branch
+// parameters
+func setParameters(spec *GitHookSpec, parameters []v1beta1.Parameter) {
+
+	var revision, branch string
+	for _, p := range parameters {
+		switch {
+		case p.Value == v1beta1.RevisionValue && revision == "":
+			revision = p.Name
+		case p.Value == v1beta1.BranchValue && branch == "":
+			branch = p.Name
+		}
+	}
+	if revision == "" && branch == "" {
+		spec.ArgoWorkflow, spec.Tekton = nil, nil
+		return
+	}
+	spec.ArgoWorkflow = &ArgoWorkflowSpec{RevisionParameterName: revision, BranchParameterName: branch}
+	spec.Tekton = &TektonSpec{RevisionParameterName: revision, BranchParameterName: branch}
+}
+
+func toNotifications(spec *GitHookSpec) []v1beta1.Notification {
+	var notifications []v1beta1.Notification
+	if spec.Notification.Github != "" {
+		notifications = append(notifications, v1beta1.Notification{Provider: v1beta1.GithubNotification, Name: spec.Notification.Github})
+	}
+	if spec.Notification.Slack != "" {
+		notifications = append(notifications, v1beta1.Notification{Provider: v1beta1.SlackNotification, Name: spec.Notification.Slack})
+	}
+	return notifications
+}
+
+// setNotifications sets Notification to the first notification of each
+// provider
+func setNotifications(spec *GitHookSpec, notifications []v1beta1.Notification) {
+	spec.Notification = NotificationSpec{}
+	for _, n := range notifications {
+		switch {
+		case n.Provider == v1beta1.GithubNotification && spec.Notification.Github == "":
+			spec.Notification.Github = n.Name
+		case n.Provider == v1beta1.SlackNotification && spec.Notification.Slack == "":
+			spec.Notification.Slack = n.Name
+		}
+	}
+}
+
+// sameList compares two lists, nil and empty lists are the same
+func sameList(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func convertStatus(in *GitHookStatus, out *v1beta1.GitHookStatus) {
+	out.LastCommit = in.LastCommit
+	out.Branch = in.Branch
+	out.Author = in.Author
+	out.AppliedResource = v1beta1.ResourceSpec(in.AppliedResource)
+	out.TriggerCount = in.TriggerCount
+	out.LastTrigger = in.LastTrigger
+	out.Conditions = nil
+	for _, c := range in.Conditions {
+		out.Conditions = append(out.Conditions, v1beta1.GitHookCondition{
+			Type:               v1beta1.GitHookConditionType(c.Type),
+			Status:             c.Status,
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		})
+	}
+}
+
+func convertStatusFrom(in *v1beta1.GitHookStatus, out *GitHookStatus) {
+	out.LastCommit = in.LastCommit
+	out.Branch = in.Branch
+	out.Author = in.Author
+	out.AppliedResource = ResourceSpec(in.AppliedResource)
+	out.TriggerCount = in.TriggerCount
+	out.LastTrigger = in.LastTrigger
+	out.Conditions = nil
+	for _, c := range in.Conditions {
+		out.Conditions = append(out.Conditions, GitHookCondition{
+			Type:               GitHookConditionType(c.Type),
+			Status:             c.Status,
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+func TestConvertAlphaRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name string
+		spec GitHookSpec
+		meta metav1.ObjectMeta
+	}{
+		{name: "no parameters"},
+		{
+			name: "same parameters",
+			spec: GitHookSpec{
+				ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "revision", BranchParameterName: "branch"},
+				Tekton:       &TektonSpec{RevisionParameterName: "revision", BranchParameterName: "branch"},
+			},
+		},
+		{
+			name: "different parameters",
+			spec: GitHookSpec{
+				ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "revision"},
+				Tekton:       &TektonSpec{RevisionParameterName: "commit"},
+			},
+		},
+		{
+			name: "argo workflow only",
+			spec: GitHookSpec{ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "revision"}},
+		},
+		{
+			name: "tekton branch only",
+			spec: GitHookSpec{Tekton: &TektonSpec{BranchParameterName: "branch"}},
+		},
+		{
+			name: "empty tekton",
+			spec: GitHookSpec{
+				ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "revision"},
+				Tekton:       &TektonSpec{},
+			},
+		},
+		{
+			name: "notifications",
+			spec: GitHookSpec{Notification: NotificationSpec{Github: "github", Slack: "slack"}},
+		},
+		{
+			name: "other annotations",
+			spec: GitHookSpec{ArgoWorkflow: &ArgoWorkflowSpec{BranchParameterName: "branch"}},
+			meta: metav1.ObjectMeta{Annotations: map[string]string{"team": "ci"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.meta.Name = "githook"
+			src := &GitHook{
+				TypeMeta:   metav1.TypeMeta{Kind: "GitHook", APIVersion: SchemeGroupVersion.String()},
+				ObjectMeta: test.meta,
+				Spec:       test.spec,
+			}
+			src.Spec.Repository = "https://github.com/appspero/kube-git.git"
+
+			var beta v1beta1.GitHook
+			if err := src.DeepCopy().ConvertTo(&beta); err != nil {
+				t.Fatalf("error converting to v1beta1: %s", err.Error())
+			}
+			var got GitHook
+			if err := got.ConvertFrom(&beta); err != nil {
+				t.Fatalf("error converting from v1beta1: %s", err.Error())
+			}
+			if !reflect.DeepEqual(&got, src) {
+				t.Errorf("got %+v, want %+v", got, *src)
+			}
+		})
+	}
+}
+
+func TestConvertBetaRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name string
+		spec v1beta1.GitHookSpec
+	}{
+		{name: "no parameters"},
+		{
+			name: "revision and branch",
+			spec: v1beta1.GitHookSpec{Parameters: []v1beta1.Parameter{
+				{Name: "revision", Value: v1beta1.RevisionValue},
+				{Name: "branch", Value: v1beta1.BranchValue},
+			}},
+		},
+		{
+			name: "several revisions",
+			spec: v1beta1.GitHookSpec{Parameters: []v1beta1.Parameter{
+				{Name: "revision", Value: v1beta1.RevisionValue},
+				{Name: "commit", Value: v1beta1.RevisionValue},
+			}},
+		},
+		{
+			name: "branch first",
+			spec: v1beta1.GitHookSpec{Parameters: []v1beta1.Parameter{
+				{Name: "branch", Value: v1beta1.BranchValue},
+				{Name: "revision", Value: v1beta1.RevisionValue},
+			}},
+		},
+		{
+			name: "several slack notifications",
+			spec: v1beta1.GitHookSpec{Notifications: []v1beta1.Notification{
+				{Provider: v1beta1.SlackNotification, Name: "builds"},
+				{Provider: v1beta1.SlackNotification, Name: "team"},
+				{Provider: v1beta1.GithubNotification, Name: "github"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := &v1beta1.GitHook{
+				TypeMeta:   metav1.TypeMeta{Kind: "GitHook", APIVersion: v1beta1.SchemeGroupVersion.String()},
+				ObjectMeta: metav1.ObjectMeta{Name: "githook"},
+				Spec:       test.spec,
+			}
+			src.Spec.Repository = "https://github.com/appspero/kube-git.git"
+
+			var alpha GitHook
+			if err := alpha.ConvertFrom(src.DeepCopy()); err != nil {
+				t.Fatalf("error converting from v1beta1: %s", err.Error())
+			}
+			var got v1beta1.GitHook
+			if err := alpha.ConvertTo(&got); err != nil {
+				t.Fatalf("error converting to v1beta1: %s", err.Error())
+			}
+			if !reflect.DeepEqual(&got, src) {
+				t.Errorf("got %+v, want %+v", got, *src)
+			}
+		})
+	}
+}
+
+func TestConvertChangedParameters(t *testing.T) {
+
+	src := &GitHook{
+		ObjectMeta: metav1.ObjectMeta{Name: "githook"},
+		Spec: GitHookSpec{
+			ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "revision"},
+			Tekton:       &TektonSpec{RevisionParameterName: "commit"},
+		},
+	}
+	var beta v1beta1.GitHook
+	if err := src.ConvertTo(&beta); err != nil {
+		t.Fatalf("error converting to v1beta1: %s", err.Error())
+	}
+	if _, ok := beta.Annotations[AlphaConversionAnnotation]; !ok {
+		t.Fatalf("missing annotation %s", AlphaConversionAnnotation)
+	}
+
+	// the fields of the v1alpha1 GitHook are dropped once the parameters change
+	beta.Spec.Parameters = []v1beta1.Parameter{{Name: "sha", Value: v1beta1.RevisionValue}}
+	var got GitHook
+	if err := got.ConvertFrom(&beta); err != nil {
+		t.Fatalf("error converting from v1beta1: %s", err.Error())
+	}
+	want := GitHookSpec{
+		ArgoWorkflow: &ArgoWorkflowSpec{RevisionParameterName: "sha"},
+		Tekton:       &TektonSpec{RevisionParameterName: "sha"},
+	}
+	if !reflect.DeepEqual(got.Spec, want) {
+		t.Errorf("got %+v, want %+v", got.Spec, want)
+	}
+	if len(got.Annotations) != 0 {
+		t.Errorf("got annotations %v, want none", got.Annotations)
+	}
+}
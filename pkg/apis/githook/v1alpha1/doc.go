@@ -1,5 +1,6 @@
 // +k8s:deepcopy-gen=package
 // +groupName=kubegit.appspero.com
+// +kubebuilder:validation:Optional
 
 // Package v1alpha1 is the v1alpha1 version of the API.
 package v1alpha1
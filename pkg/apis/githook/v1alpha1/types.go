@@ -1,46 +1,185 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=gh
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Repository",type=string,JSONPath=`.spec.repository`,description="The git repository of the GitHook"
+// +kubebuilder:printcolumn:name="Trigger Count",type=string,JSONPath=`.status.triggerCount`,description="The triggering count of the GitHook since creation"
+// +kubebuilder:printcolumn:name="Last Trigger",type=date,JSONPath=`.status.lastTrigger`,description="The last triggering time of the GitHook"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // GitHook is a specification for a GitHook resource
 type GitHook struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
+	// +kubebuilder:validation:Required
 	Spec   GitHookSpec   `json:"spec"`
 	Status GitHookStatus `json:"status"`
 }
 
 // GitHookSpec is the spec for a GitHook resource
 type GitHookSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
 	Repository            string   `json:"repository"`
+  // +kubebuilder:validation:Required
+  // +kubebuilder:validation:MinItems=1
   Branches              []string `json:"branches"`
   Manifest              string   `json:"manifest"`
 
+	// ManifestFrom takes the manifest from the GitHook itself or from a
+	// ConfigMap instead of reading Manifest from the repository
+	ManifestFrom          *ManifestSource `json:"manifestFrom"`
+
+	// Submodules reads Manifest from a submodule if its path is in one, the
+	// submodule is fetched with the same credentials
+	Submodules            bool `json:"submodules"`
+	// LFS downloads Manifest from the Git LFS server if it's stored with Git LFS
+	LFS                   bool `json:"lfs"`
+
+	// ContentAPI is used to read Manifest if fetching it with git fails
+	ContentAPI            *ContentAPISpec `json:"contentAPI"`
+
 	TimestampSuffix       bool `json:"timestampSuffix"`
 
+	// ServiceAccountName is the ServiceAccount of the namespace of the GitHook
+	// impersonated to create the resources, so its RBAC governs what a pushed
+	// manifest may create. The default ServiceAccount is impersonated if not set
+	// +kubebuilder:validation:Pattern=`^$|^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	ServiceAccountName    string `json:"serviceAccountName"`
+
+	// AllowedNamespaces are the namespaces the resources may be created in, and
+	// AllowedKinds their kinds. Any allowed by the policy of the controller if
+	// empty. The namespace of a resource is the one of the GitHook if not set
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	AllowedNamespaces     []string `json:"allowedNamespaces,omitempty"`
+	// +kubebuilder:validation:items:Enum=Job;Workflow;PipelineRun;TaskRun
+	AllowedKinds          []string `json:"allowedKinds,omitempty"`
+
+	// ConcurrencyPolicy is how a push is applied while the resource created for
+	// a previous push of the same branch is still running, default is Allow
+	// +kubebuilder:default=Allow
+	ConcurrencyPolicy     ConcurrencyPolicy `json:"concurrencyPolicy"`
+
+	// number of succeeded and failed resources created by the GitHook to keep,
+	// the oldest are deleted. All are kept if not set
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	FailedRunsHistoryLimit     *int32 `json:"failedRunsHistoryLimit,omitempty"`
+
+	// DisableOwnerReferences doesn't set an ownerReference to the GitHook on the
+	// resources created in its namespace, so they are kept when it's deleted
+	DisableOwnerReferences bool `json:"disableOwnerReferences"`
+	// CleanupPolicy is what happens to the resources created in other namespaces
+	// when the GitHook is deleted, default is Orphan
+	// +kubebuilder:default=Orphan
+	CleanupPolicy          CleanupPolicy `json:"cleanupPolicy"`
+
 	ArgoWorkflow          *ArgoWorkflowSpec `json:"argoWorkflow"`
+	Tekton                *TektonSpec       `json:"tekton"`
 
 	UsernameSecret        Secret `json:"usernameSecret"`
 	PasswordSecret				Secret `json:"passwordSecret"`
   SshPrivateKeySecret   Secret `json:"sshPrivateKeySecret"`
+	// passphrase of an encrypted SSH private key
+	SshPassphraseSecret   Secret `json:"sshPassphraseSecret"`
+	// SSH user, default is the user of the repository URL or "git"
+	SshUser               string `json:"sshUser"`
+
+	// name of a GitHub notification config whose GitHub App installation token
+	// is used to fetch HTTPS repositories instead of UsernameSecret/PasswordSecret
+	GithubApp             string `json:"githubApp"`
+
+	// known_hosts used to verify the SSH host key of the repository, in addition
+	// to the known_hosts file of the controller
+	KnownHostsSecret      Secret       `json:"knownHostsSecret"`
+	KnownHostsConfigMap   ConfigMapKey `json:"knownHostsConfigMap"`
+	// don't verify the SSH host key when no known hosts are configured
+	SshInsecureIgnoreHostKey bool      `json:"sshInsecureIgnoreHostKey"`
+
+	// only trigger for commits signed by trusted keys
+	SignatureVerification *SignatureVerificationSpec `json:"signatureVerification"`
 
 	Notification NotificationSpec `json:"notification"`
 }
 
+// ConcurrencyPolicy describes how the resources created for the pushes of a
+// branch run concurrently
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace;Queue
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent creates the resource of every push
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips the pushes while the previous resource is running
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent stops the running resource before creating the new one
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+	// QueueConcurrent creates the resource once the previous one finished
+	QueueConcurrent ConcurrencyPolicy = "Queue"
+)
+
+// CleanupPolicy describes what happens to the resources created by a GitHook in
+// other namespaces when it's deleted
+// +kubebuilder:validation:Enum=Orphan;Delete
+type CleanupPolicy string
+
+const (
+	// OrphanResources keeps the resources
+	OrphanResources CleanupPolicy = "Orphan"
+	// DeleteResources deletes the resources before the GitHook is deleted
+	DeleteResources CleanupPolicy = "Delete"
+)
+
+// CleanupFinalizer is set on the GitHooks with the Delete cleanup policy until
+// the resources created in other namespaces are deleted
+const CleanupFinalizer = "kubegit.appspero.com/cleanup"
+
 // GitHookStatus is the status for a GitHook resource
 type GitHookStatus struct {
 	LastCommit       string       `json:"lastCommit"`
 	Branch           string       `json:"branch"`
 	Author           string       `json:"author"`
 	AppliedResource  ResourceSpec `json:"appliedResource"`
+	// +kubebuilder:validation:Minimum=0
 	TriggerCount     int64        `json:"triggerCount"`
+	// +nullable
 	LastTrigger      metav1.Time  `json:"lastTrigger,omitempty"`
+	Conditions       []GitHookCondition `json:"conditions,omitempty"`
+}
+
+// GitHookConditionType is the type of a GitHook condition
+type GitHookConditionType string
+
+const (
+	// HostKeyVerified is false when the SSH host key of the repository is unknown or doesn't match the known hosts
+	HostKeyVerified GitHookConditionType = "HostKeyVerified"
+	// SignatureVerified is false when the pushed commit isn't signed by a trusted key
+	SignatureVerified GitHookConditionType = "SignatureVerified"
+)
+
+// GitHookCondition is an observation of the state of a GitHook
+type GitHookCondition struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=HostKeyVerified;SignatureVerified
+	Type               GitHookConditionType `json:"type"`
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status             corev1.ConditionStatus `json:"status"`
+	// +nullable
+	LastTransitionTime metav1.Time          `json:"lastTransitionTime,omitempty"`
+	Reason             string               `json:"reason,omitempty"`
+	Message            string               `json:"message,omitempty"`
 }
 
 // ResourceSpec is the spec of a k8s resource that is used by GitHook
@@ -58,6 +197,7 @@ type NotificationSpec struct {
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
 
 // GitHookList is a list of GitHook resources
 type GitHookList struct {
@@ -73,8 +213,52 @@ type ArgoWorkflowSpec struct {
 	BranchParameterName   string `json:"branchParameterName"`
 }
 
+// TektonSpec is the spec for a Tekton PipelineRun or TaskRun
+type TektonSpec struct {
+	RevisionParameterName string `json:"revisionParameterName"`
+	BranchParameterName   string `json:"branchParameterName"`
+}
+
+// ManifestSource is the source of a manifest that is not read from the repository.
+// Only one of Inline or ConfigMap should be set
+type ManifestSource struct {
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Inline    *runtime.RawExtension `json:"inline"`
+	ConfigMap *ConfigMapKey         `json:"configMap"`
+}
+
+// ContentAPISpec is the file content API of the git provider of the repository.
+// The password of PasswordSecret is used as the API token
+type ContentAPISpec struct {
+	// Provider of the API, only "github" is supported
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=github
+	Provider string `json:"provider"`
+	// URL of the API, default is https://api.github.com for GitHub
+	// +kubebuilder:default="https://api.github.com"
+	// +kubebuilder:validation:Pattern=`^$|^https?://`
+	URL      string `json:"url"`
+}
+
+// ConfigMapKey is a key of a ConfigMap in the namespace of the GitHook
+type ConfigMapKey struct {
+  // +kubebuilder:validation:Required
+  Name string `json:"name"`
+  // +kubebuilder:validation:Required
+  Key  string `json:"key"`
+}
+
 // Secret is a secret type for the repository auth of a GitHook resource
 type Secret struct {
+  // +kubebuilder:validation:Required
   Name string `json:"name"`
+  // +kubebuilder:validation:Required
   Key  string `json:"key"`
 }
+
+// SignatureVerificationSpec references the armored OpenPGP public keys trusted
+// to sign the pushed commits, all the keys of the Secret and ConfigMap are read
+type SignatureVerificationSpec struct {
+	Secret    string `json:"secret"`
+	ConfigMap string `json:"configMap"`
+}
@@ -40,6 +40,38 @@ func (in *ArgoWorkflowSpec) DeepCopy() *ArgoWorkflowSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapKey) DeepCopyInto(out *ConfigMapKey) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapKey.
+func (in *ConfigMapKey) DeepCopy() *ConfigMapKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContentAPISpec) DeepCopyInto(out *ContentAPISpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContentAPISpec.
+func (in *ContentAPISpec) DeepCopy() *ContentAPISpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ContentAPISpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitHook) DeepCopyInto(out *GitHook) {
 	*out = *in
@@ -68,6 +100,23 @@ func (in *GitHook) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitHookCondition) DeepCopyInto(out *GitHookCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitHookCondition.
+func (in *GitHookCondition) DeepCopy() *GitHookCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(GitHookCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitHookList) DeepCopyInto(out *GitHookList) {
 	*out = *in
@@ -109,14 +158,57 @@ func (in *GitHookSpec) DeepCopyInto(out *GitHookSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ManifestFrom != nil {
+		in, out := &in.ManifestFrom, &out.ManifestFrom
+		*out = new(ManifestSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ContentAPI != nil {
+		in, out := &in.ContentAPI, &out.ContentAPI
+		*out = new(ContentAPISpec)
+		**out = **in
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedKinds != nil {
+		in, out := &in.AllowedKinds, &out.AllowedKinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SuccessfulRunsHistoryLimit != nil {
+		in, out := &in.SuccessfulRunsHistoryLimit, &out.SuccessfulRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedRunsHistoryLimit != nil {
+		in, out := &in.FailedRunsHistoryLimit, &out.FailedRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 	if in.ArgoWorkflow != nil {
 		in, out := &in.ArgoWorkflow, &out.ArgoWorkflow
 		*out = new(ArgoWorkflowSpec)
 		**out = **in
 	}
+	if in.Tekton != nil {
+		in, out := &in.Tekton, &out.Tekton
+		*out = new(TektonSpec)
+		**out = **in
+	}
 	out.UsernameSecret = in.UsernameSecret
 	out.PasswordSecret = in.PasswordSecret
 	out.SshPrivateKeySecret = in.SshPrivateKeySecret
+	out.SshPassphraseSecret = in.SshPassphraseSecret
+	out.KnownHostsSecret = in.KnownHostsSecret
+	out.KnownHostsConfigMap = in.KnownHostsConfigMap
+	if in.SignatureVerification != nil {
+		in, out := &in.SignatureVerification, &out.SignatureVerification
+		*out = new(SignatureVerificationSpec)
+		**out = **in
+	}
 	out.Notification = in.Notification
 	return
 }
@@ -136,6 +228,13 @@ func (in *GitHookStatus) DeepCopyInto(out *GitHookStatus) {
 	*out = *in
 	out.AppliedResource = in.AppliedResource
 	in.LastTrigger.DeepCopyInto(&out.LastTrigger)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]GitHookCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -149,6 +248,32 @@ func (in *GitHookStatus) DeepCopy() *GitHookStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManifestSource) DeepCopyInto(out *ManifestSource) {
+	*out = *in
+	if in.Inline != nil {
+		in, out := &in.Inline, &out.Inline
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ConfigMapKey)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManifestSource.
+func (in *ManifestSource) DeepCopy() *ManifestSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ManifestSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NotificationSpec) DeepCopyInto(out *NotificationSpec) {
 	*out = *in
@@ -196,3 +321,35 @@ func (in *Secret) DeepCopy() *Secret {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignatureVerificationSpec) DeepCopyInto(out *SignatureVerificationSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignatureVerificationSpec.
+func (in *SignatureVerificationSpec) DeepCopy() *SignatureVerificationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SignatureVerificationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TektonSpec) DeepCopyInto(out *TektonSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TektonSpec.
+func (in *TektonSpec) DeepCopy() *TektonSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TektonSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,6 @@
+// +k8s:deepcopy-gen=package
+// +groupName=kubegit.appspero.com
+// +kubebuilder:validation:Optional
+
+// Package v1beta1 is the v1beta1 version of the API.
+package v1beta1
@@ -0,0 +1,313 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:resource:shortName=gh
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Repository",type=string,JSONPath=`.spec.repository`,description="The git repository of the GitHook"
+// +kubebuilder:printcolumn:name="Trigger Count",type=string,JSONPath=`.status.triggerCount`,description="The triggering count of the GitHook since creation"
+// +kubebuilder:printcolumn:name="Last Trigger",type=date,JSONPath=`.status.lastTrigger`,description="The last triggering time of the GitHook"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// GitHook is a specification for a GitHook resource
+type GitHook struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Spec   GitHookSpec   `json:"spec"`
+	Status GitHookStatus `json:"status"`
+}
+
+// GitHookSpec is the spec for a GitHook resource
+type GitHookSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Repository string `json:"repository"`
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Branches []string `json:"branches"`
+	Manifest string   `json:"manifest,omitempty"`
+
+	// ManifestFrom takes the manifest from the GitHook itself or from a
+	// ConfigMap instead of reading Manifest from the repository
+	ManifestFrom *ManifestSource `json:"manifestFrom,omitempty"`
+
+	// Submodules reads Manifest from a submodule if its path is in one, the
+	// submodule is fetched with the same credentials
+	Submodules bool `json:"submodules,omitempty"`
+	// LFS downloads Manifest from the Git LFS server if it's stored with Git LFS
+	LFS bool `json:"lfs,omitempty"`
+
+	// ContentAPI is used to read Manifest if fetching it with git fails
+	ContentAPI *ContentAPISpec `json:"contentAPI,omitempty"`
+
+	// Auth are the credentials of the repository
+	Auth AuthSpec `json:"auth,omitempty"`
+
+	// only trigger for commits signed by trusted keys
+	SignatureVerification *SignatureVerificationSpec `json:"signatureVerification,omitempty"`
+
+	TimestampSuffix bool `json:"timestampSuffix,omitempty"`
+
+	// Parameters of the created Workflow, PipelineRun or TaskRun set to the
+	// values of the push. Only the parameters the resource defines are set.
+	Parameters []Parameter `json:"parameters,omitempty"`
+
+	// ServiceAccountName is the ServiceAccount of the namespace of the GitHook
+	// impersonated to create the resources, so its RBAC governs what a pushed
+	// manifest may create. The default ServiceAccount is impersonated if not set
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// AllowedNamespaces are the namespaces the resources may be created in, and
+	// AllowedKinds their kinds. Any allowed by the policy of the controller if
+	// empty. The namespace of a resource is the one of the GitHook if not set
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// +kubebuilder:validation:items:Enum=Job;Workflow;PipelineRun;TaskRun
+	AllowedKinds []string `json:"allowedKinds,omitempty"`
+
+	// ConcurrencyPolicy is how a push is applied while the resource created for
+	// a previous push of the same branch is still running, default is Allow
+	// +kubebuilder:default=Allow
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// number of succeeded and failed resources created by the GitHook to keep,
+	// the oldest are deleted. All are kept if not set
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+
+	// DisableOwnerReferences doesn't set an ownerReference to the GitHook on the
+	// resources created in its namespace, so they are kept when it's deleted
+	DisableOwnerReferences bool `json:"disableOwnerReferences,omitempty"`
+	// CleanupPolicy is what happens to the resources created in other namespaces
+	// when the GitHook is deleted, default is Orphan
+	// +kubebuilder:default=Orphan
+	CleanupPolicy CleanupPolicy `json:"cleanupPolicy,omitempty"`
+
+	// Notifications are the notification configs of the controller notified
+	// of the status of the created resources
+	Notifications []Notification `json:"notifications,omitempty"`
+}
+
+// AuthSpec are the credentials of the repository, only one of Basic, SSH or
+// GithubApp should be set
+type AuthSpec struct {
+	// Basic auth for HTTPS repositories, its password is also the token of the
+	// content API
+	Basic *BasicAuth `json:"basic,omitempty"`
+	// SSH auth for SSH repositories
+	SSH *SSHAuth `json:"ssh,omitempty"`
+	// name of a GitHub notification config whose GitHub App installation token
+	// is used to fetch HTTPS repositories
+	GithubApp string `json:"githubApp,omitempty"`
+}
+
+// BasicAuth is the username and password of an HTTPS repository
+type BasicAuth struct {
+	// +kubebuilder:validation:Required
+	UsernameSecret SecretKeySelector `json:"usernameSecret"`
+	// +kubebuilder:validation:Required
+	PasswordSecret SecretKeySelector `json:"passwordSecret"`
+}
+
+// SSHAuth is the private key of an SSH repository and the known hosts used to
+// verify its host key
+type SSHAuth struct {
+	// +kubebuilder:validation:Required
+	PrivateKeySecret SecretKeySelector `json:"privateKeySecret"`
+	// passphrase of an encrypted private key
+	PassphraseSecret *SecretKeySelector `json:"passphraseSecret,omitempty"`
+	// User is the SSH user, default is the user of the repository URL or "git"
+	User string `json:"user,omitempty"`
+
+	// known_hosts used to verify the SSH host key of the repository, in addition
+	// to the known_hosts file of the controller
+	KnownHostsSecret    *SecretKeySelector    `json:"knownHostsSecret,omitempty"`
+	KnownHostsConfigMap *ConfigMapKeySelector `json:"knownHostsConfigMap,omitempty"`
+	// InsecureIgnoreHostKey fetches the repository without verifying its host
+	// key when no known hosts are configured, instead of failing
+	InsecureIgnoreHostKey bool `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+// Parameter is a parameter of the created resource set to a value of the push
+type Parameter struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:Required
+	Value ParameterValue `json:"value"`
+}
+
+// ParameterValue is the value of the push a Parameter is set to
+// +kubebuilder:validation:Enum=revision;branch
+type ParameterValue string
+
+const (
+	// RevisionValue is the pushed commit
+	RevisionValue ParameterValue = "revision"
+	// BranchValue is the pushed branch
+	BranchValue ParameterValue = "branch"
+)
+
+// Notification is a notification config of the controller
+type Notification struct {
+	// Provider is github or slack
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=github;slack
+	Provider string `json:"provider"`
+	// Name of the notification config of the provider
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+const (
+	GithubNotification = "github"
+	SlackNotification  = "slack"
+)
+
+// ConcurrencyPolicy describes how the resources created for the pushes of a
+// branch run concurrently
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace;Queue
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent creates the resource of every push
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips the pushes while the previous resource is running
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent stops the running resource before creating the new one
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+	// QueueConcurrent creates the resource once the previous one finished
+	QueueConcurrent ConcurrencyPolicy = "Queue"
+)
+
+// CleanupPolicy describes what happens to the resources created by a GitHook in
+// other namespaces when it's deleted
+// +kubebuilder:validation:Enum=Orphan;Delete
+type CleanupPolicy string
+
+const (
+	// OrphanResources keeps the resources
+	OrphanResources CleanupPolicy = "Orphan"
+	// DeleteResources deletes the resources before the GitHook is deleted
+	DeleteResources CleanupPolicy = "Delete"
+)
+
+// CleanupFinalizer is set on the GitHooks with the Delete cleanup policy until
+// the resources created in other namespaces are deleted
+const CleanupFinalizer = "kubegit.appspero.com/cleanup"
+
+// GitHookStatus is the status for a GitHook resource
+type GitHookStatus struct {
+	LastCommit      string       `json:"lastCommit"`
+	Branch          string       `json:"branch"`
+	Author          string       `json:"author"`
+	AppliedResource ResourceSpec `json:"appliedResource"`
+	// +kubebuilder:validation:Minimum=0
+	TriggerCount int64 `json:"triggerCount"`
+	// +nullable
+	LastTrigger metav1.Time        `json:"lastTrigger,omitempty"`
+	Conditions  []GitHookCondition `json:"conditions,omitempty"`
+}
+
+// GitHookConditionType is the type of a GitHook condition
+type GitHookConditionType string
+
+const (
+	// HostKeyVerified is false when the SSH host key of the repository is unknown or doesn't match the known hosts
+	HostKeyVerified GitHookConditionType = "HostKeyVerified"
+	// SignatureVerified is false when the pushed commit isn't signed by a trusted key
+	SignatureVerified GitHookConditionType = "SignatureVerified"
+)
+
+// GitHookCondition is an observation of the state of a GitHook
+type GitHookCondition struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=HostKeyVerified;SignatureVerified
+	Type GitHookConditionType `json:"type"`
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// +nullable
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+}
+
+// ResourceSpec is the spec of a k8s resource that is used by GitHook
+type ResourceSpec struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// GitHookList is a list of GitHook resources
+type GitHookList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []GitHook `json:"items"`
+}
+
+// ManifestSource is the source of a manifest that is not read from the repository.
+// Only one of Inline or ConfigMap should be set
+type ManifestSource struct {
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Inline    *runtime.RawExtension `json:"inline,omitempty"`
+	ConfigMap *ConfigMapKeySelector `json:"configMap,omitempty"`
+}
+
+// ContentAPISpec is the file content API of the git provider of the repository.
+// The password of the basic auth is used as the API token
+type ContentAPISpec struct {
+	// Provider of the API, only "github" is supported
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=github
+	Provider string `json:"provider"`
+	// URL of the API, default is https://api.github.com for GitHub
+	// +kubebuilder:default="https://api.github.com"
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url,omitempty"`
+}
+
+// ConfigMapKeySelector is a key of a ConfigMap in the namespace of the GitHook
+type ConfigMapKeySelector struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Name string `json:"name"`
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// SecretKeySelector is a key of a Secret in the namespace of the GitHook
+type SecretKeySelector struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Name string `json:"name"`
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// SignatureVerificationSpec references the armored OpenPGP public keys trusted
+// to sign the pushed commits, all the keys of the Secret and ConfigMap are read
+type SignatureVerificationSpec struct {
+	Secret    string `json:"secret,omitempty"`
+	ConfigMap string `json:"configMap,omitempty"`
+}
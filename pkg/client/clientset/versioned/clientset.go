@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	kubegitv1alpha1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1alpha1"
+	kubegitv1beta1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1beta1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -30,6 +31,7 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	KubegitV1alpha1() kubegitv1alpha1.KubegitV1alpha1Interface
+	KubegitV1beta1() kubegitv1beta1.KubegitV1beta1Interface
 }
 
 // Clientset contains the clients for groups. Each group has exactly one
@@ -37,6 +39,7 @@ type Interface interface {
 type Clientset struct {
 	*discovery.DiscoveryClient
 	kubegitV1alpha1 *kubegitv1alpha1.KubegitV1alpha1Client
+	kubegitV1beta1  *kubegitv1beta1.KubegitV1beta1Client
 }
 
 // KubegitV1alpha1 retrieves the KubegitV1alpha1Client
@@ -44,6 +47,11 @@ func (c *Clientset) KubegitV1alpha1() kubegitv1alpha1.KubegitV1alpha1Interface {
 	return c.kubegitV1alpha1
 }
 
+// KubegitV1beta1 retrieves the KubegitV1beta1Client
+func (c *Clientset) KubegitV1beta1() kubegitv1beta1.KubegitV1beta1Interface {
+	return c.kubegitV1beta1
+}
+
 // Discovery retrieves the DiscoveryClient
 func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 	if c == nil {
@@ -69,6 +77,10 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 	if err != nil {
 		return nil, err
 	}
+	cs.kubegitV1beta1, err = kubegitv1beta1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
 
 	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
 	if err != nil {
@@ -82,6 +94,7 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 func NewForConfigOrDie(c *rest.Config) *Clientset {
 	var cs Clientset
 	cs.kubegitV1alpha1 = kubegitv1alpha1.NewForConfigOrDie(c)
+	cs.kubegitV1beta1 = kubegitv1beta1.NewForConfigOrDie(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
 	return &cs
@@ -91,6 +104,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.kubegitV1alpha1 = kubegitv1alpha1.New(c)
+	cs.kubegitV1beta1 = kubegitv1beta1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
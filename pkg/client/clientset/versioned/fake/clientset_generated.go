@@ -22,6 +22,8 @@ import (
 	clientset "github.com/appspero/kube-git/pkg/client/clientset/versioned"
 	kubegitv1alpha1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1alpha1"
 	fakekubegitv1alpha1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1alpha1/fake"
+	kubegitv1beta1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1beta1"
+	fakekubegitv1beta1 "github.com/appspero/kube-git/pkg/client/clientset/versioned/typed/githook/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -80,3 +82,8 @@ var _ clientset.Interface = &Clientset{}
 func (c *Clientset) KubegitV1alpha1() kubegitv1alpha1.KubegitV1alpha1Interface {
 	return &fakekubegitv1alpha1.FakeKubegitV1alpha1{Fake: &c.Fake}
 }
+
+// KubegitV1beta1 retrieves the KubegitV1beta1Client
+func (c *Clientset) KubegitV1beta1() kubegitv1beta1.KubegitV1beta1Interface {
+	return &fakekubegitv1beta1.FakeKubegitV1beta1{Fake: &c.Fake}
+}
@@ -20,6 +20,7 @@ package scheme
 
 import (
 	kubegitv1alpha1 "github.com/appspero/kube-git/pkg/apis/githook/v1alpha1"
+	kubegitv1beta1 "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
@@ -32,6 +33,7 @@ var Codecs = serializer.NewCodecFactory(Scheme)
 var ParameterCodec = runtime.NewParameterCodec(Scheme)
 var localSchemeBuilder = runtime.SchemeBuilder{
 	kubegitv1alpha1.AddToScheme,
+	kubegitv1beta1.AddToScheme,
 }
 
 // AddToScheme adds all types of this clientset into the given scheme. This allows composition
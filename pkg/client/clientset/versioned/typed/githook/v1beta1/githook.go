@@ -0,0 +1,191 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"time"
+
+	v1beta1 "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	scheme "github.com/appspero/kube-git/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// GitHooksGetter has a method to return a GitHookInterface.
+// A group's client should implement this interface.
+type GitHooksGetter interface {
+	GitHooks(namespace string) GitHookInterface
+}
+
+// GitHookInterface has methods to work with GitHook resources.
+type GitHookInterface interface {
+	Create(*v1beta1.GitHook) (*v1beta1.GitHook, error)
+	Update(*v1beta1.GitHook) (*v1beta1.GitHook, error)
+	UpdateStatus(*v1beta1.GitHook) (*v1beta1.GitHook, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1beta1.GitHook, error)
+	List(opts v1.ListOptions) (*v1beta1.GitHookList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.GitHook, err error)
+	GitHookExpansion
+}
+
+// gitHooks implements GitHookInterface
+type gitHooks struct {
+	client rest.Interface
+	ns     string
+}
+
+// newGitHooks returns a GitHooks
+func newGitHooks(c *KubegitV1beta1Client, namespace string) *gitHooks {
+	return &gitHooks{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the gitHook, and returns the corresponding gitHook object, and an error if there is any.
+func (c *gitHooks) Get(name string, options v1.GetOptions) (result *v1beta1.GitHook, err error) {
+	result = &v1beta1.GitHook{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("githooks").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of GitHooks that match those selectors.
+func (c *gitHooks) List(opts v1.ListOptions) (result *v1beta1.GitHookList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1beta1.GitHookList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("githooks").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested gitHooks.
+func (c *gitHooks) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("githooks").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a gitHook and creates it.  Returns the server's representation of the gitHook, and an error, if there is any.
+func (c *gitHooks) Create(gitHook *v1beta1.GitHook) (result *v1beta1.GitHook, err error) {
+	result = &v1beta1.GitHook{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("githooks").
+		Body(gitHook).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a gitHook and updates it. Returns the server's representation of the gitHook, and an error, if there is any.
+func (c *gitHooks) Update(gitHook *v1beta1.GitHook) (result *v1beta1.GitHook, err error) {
+	result = &v1beta1.GitHook{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("githooks").
+		Name(gitHook.Name).
+		Body(gitHook).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *gitHooks) UpdateStatus(gitHook *v1beta1.GitHook) (result *v1beta1.GitHook, err error) {
+	result = &v1beta1.GitHook{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("githooks").
+		Name(gitHook.Name).
+		SubResource("status").
+		Body(gitHook).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the gitHook and deletes it. Returns an error if one occurs.
+func (c *gitHooks) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("githooks").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *gitHooks) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("githooks").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched gitHook.
+func (c *gitHooks) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1beta1.GitHook, err error) {
+	result = &v1beta1.GitHook{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("githooks").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
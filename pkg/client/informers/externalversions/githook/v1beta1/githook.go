@@ -0,0 +1,89 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	time "time"
+
+	githookv1beta1 "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	versioned "github.com/appspero/kube-git/pkg/client/clientset/versioned"
+	internalinterfaces "github.com/appspero/kube-git/pkg/client/informers/externalversions/internalinterfaces"
+	v1beta1 "github.com/appspero/kube-git/pkg/client/listers/githook/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// GitHookInformer provides access to a shared informer and lister for
+// GitHooks.
+type GitHookInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1beta1.GitHookLister
+}
+
+type gitHookInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
+}
+
+// NewGitHookInformer constructs a new informer for GitHook type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewGitHookInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredGitHookInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredGitHookInformer constructs a new informer for GitHook type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredGitHookInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.KubegitV1beta1().GitHooks(namespace).List(options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.KubegitV1beta1().GitHooks(namespace).Watch(options)
+			},
+		},
+		&githookv1beta1.GitHook{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *gitHookInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredGitHookInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *gitHookInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&githookv1beta1.GitHook{}, f.defaultInformer)
+}
+
+func (f *gitHookInformer) Lister() v1beta1.GitHookLister {
+	return v1beta1.NewGitHookLister(f.Informer().GetIndexer())
+}
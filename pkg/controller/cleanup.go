@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// syncGitHook adds the cleanup finalizer to the GitHooks with the Delete
+// cleanup policy, and deletes the resources they created in other namespaces
+// once they are deleted. The resources in the namespace of the GitHook are
+// deleted by the garbage collector from their ownerReference.
+func (c *Controller) syncGitHook(task Task) error {
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(task.Key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve githook by key %q: %v", task.Key, err)
+	}
+	gh, exists := c.GetGitHook(namespace, name)
+	if !exists {
+		return nil
+	}
+	gh = gh.DeepCopy()
+
+	has := hasCleanupFinalizer(gh)
+	if gh.DeletionTimestamp != nil {
+		if !has {
+			return nil
+		}
+		if gh.Spec.CleanupPolicy == ghapi.DeleteResources {
+			if err := c.cleanupRuns(gh); err != nil {
+				return err
+			}
+		}
+	} else if has == (gh.Spec.CleanupPolicy == ghapi.DeleteResources) {
+		return nil
+	}
+
+	if has {
+		var finalizers []string
+		for _, f := range gh.Finalizers {
+			if f != ghapi.CleanupFinalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		gh.Finalizers = finalizers
+	} else {
+		gh.Finalizers = append(gh.Finalizers, ghapi.CleanupFinalizer)
+	}
+	// a conflict is retried by the queue with the updated GitHook
+	_, err = c.ghClientset.KubegitV1beta1().GitHooks(gh.Namespace).Update(gh)
+	return err
+}
+
+// cleanupRuns deletes the resources created by the GitHook in other namespaces
+func (c *Controller) cleanupRuns(gh *ghapi.GitHook) error {
+
+	kinds := []string{"Job", "Workflow"}
+	if c.prInformer != nil {
+		kinds = append(kinds, "PipelineRun", "TaskRun")
+	}
+
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	opts := metav1.ListOptions{LabelSelector: GitHookUIDLabel + "=" + string(gh.UID)}
+	for _, kind := range kinds {
+		var runs []run
+		for _, namespace := range namespaces {
+			r, err := c.listRuns(kind, namespace, opts)
+			if err != nil {
+				return fmt.Errorf("listing %ss of GitHook %s/%s: %v", kind, gh.Namespace, gh.Name, err)
+			}
+			runs = append(runs, r...)
+		}
+		for _, r := range runs {
+			if r.namespace == gh.Namespace {
+				continue
+			}
+			klog.Infof("Deleting %s %s/%s of deleted GitHook %s/%s", kind, r.namespace, r.name, gh.Namespace, gh.Name)
+			// already deleted since it was listed
+			if err := c.deleteRun(kind, r.namespace, r.name); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("deleting %s %s/%s: %v", kind, r.namespace, r.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// gitHookNeedsSync is true if the cleanup finalizer of the GitHook has to be
+// added or removed
+func gitHookNeedsSync(gh *ghapi.GitHook) bool {
+	return gh.Spec.CleanupPolicy == ghapi.DeleteResources || hasCleanupFinalizer(gh)
+}
+
+func hasCleanupFinalizer(gh *ghapi.GitHook) bool {
+	for _, f := range gh.Finalizers {
+		if f == ghapi.CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
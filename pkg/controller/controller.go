@@ -1,27 +1,36 @@
 package controller
 
 import (
+  "context"
   "fmt"
+  "sync"
   "time"
 
   "k8s.io/klog"
   "k8s.io/client-go/tools/cache"
-  "k8s.io/apimachinery/pkg/fields"
+  "k8s.io/apimachinery/pkg/labels"
   metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+  k8sruntime "k8s.io/apimachinery/pkg/runtime"
+  "k8s.io/apimachinery/pkg/runtime/schema"
+  "k8s.io/apimachinery/pkg/watch"
 
   batch "k8s.io/api/batch/v1"
 
   argo "github.com/argoproj/argo/pkg/apis/workflow/v1alpha1"
 
-  ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1alpha1"
+  ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
   ghclient "github.com/appspero/kube-git/pkg/client/clientset/versioned"
+  ghinformers "github.com/appspero/kube-git/pkg/client/informers/externalversions"
+  ghlisters "github.com/appspero/kube-git/pkg/client/listers/githook/v1beta1"
 	wfclient "github.com/argoproj/argo/pkg/client/clientset/versioned"
 
   "k8s.io/client-go/util/workqueue"
   "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
   "k8s.io/client-go/kubernetes"
+  "k8s.io/client-go/dynamic"
 
+  "github.com/appspero/kube-git/pkg/git"
   "github.com/appspero/kube-git/pkg/notification"
 
   "encoding/json"
@@ -34,17 +43,35 @@ const (
 	maxRetries   = 5
 )
 
+var (
+	PipelineRunResource = schema.GroupVersionResource{Group: "tekton.dev", Version: "v1beta1", Resource: "pipelineruns"}
+	TaskRunResource     = schema.GroupVersionResource{Group: "tekton.dev", Version: "v1beta1", Resource: "taskruns"}
+)
+
 type Controller struct {
   clientset   kubernetes.Interface
-  jobInformer cache.SharedIndexInformer
+  jobInformer namespacedInformer
 
   wfClientset wfclient.Interface
-  wfInformer  cache.SharedIndexInformer
+  wfInformer  namespacedInformer
 
   ghClientset ghclient.Interface
-  ghInformer  cache.SharedIndexInformer
+  // the GitHook informers of the shared informer factories, indexed by repository
+  ghFactories []ghinformers.SharedInformerFactory
+  ghInformer  namespacedInformer
+  ghListers   []ghlisters.GitHookLister
+
+  // Tekton informers are nil when tekton.dev/v1beta1 is not served by the cluster
+  dynClientset dynamic.Interface
+  prInformer   namespacedInformer
+  trInformer   namespacedInformer
 
-  queue workqueue.RateLimitingInterface
+  // namespaces watched, all if empty
+  namespaces []string
+
+  queue *leaderQueue
+  // workers counts the running workers, they return once the queue is shut down and drained
+  workers sync.WaitGroup
 
   notification *notification.Config
 }
@@ -55,17 +82,20 @@ type Task struct {
   Type   string
 }
 
-func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interface, ghClientset ghclient.Interface, notificationConfig *notification.Config) *Controller {
+// NewController watches the GitHooks of namespaces, and the Jobs, Workflows and
+// Tekton runs matching labelSelector in namespaces. All the namespaces are
+// watched if namespaces is empty.
+func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interface, ghClientset ghclient.Interface, dynClientset dynamic.Interface, notificationConfig *notification.Config, namespaces []string, labelSelector string) *Controller {
+
+    queue := &leaderQueue{RateLimitingInterface: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "controller")}
 
-    queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+    selectLabels := func(options *metav1.ListOptions) {
+      options.LabelSelector = labelSelector
+    }
 
-    jobListwatch := cache.NewListWatchFromClient(clientset.BatchV1().RESTClient(), "jobs", metav1.NamespaceAll, fields.Everything())
-    jobInformer := cache.NewSharedIndexInformer(
-  		jobListwatch,
-  		&batch.Job{},
-  		resyncPeriod,
-  		cache.Indexers{},
-  	)
+    jobInformer := newNamespacedInformer(namespaces, func(namespace string) cache.ListerWatcher {
+      return cache.NewFilteredListWatchFromClient(clientset.BatchV1().RESTClient(), "jobs", namespace, selectLabels)
+    }, &batch.Job{})
     jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
       AddFunc: func(obj interface{}) {
         key, err := cache.MetaNamespaceKeyFunc(obj)
@@ -94,6 +124,13 @@ func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interfac
   						Type: "Job",
   					})
   				}
+  				if job.ObjectMeta.Labels[GitHookUIDLabel] != "" && !jobFinished(old.(*batch.Job)) && jobFinished(job) {
+  					queue.Add(Task{
+  						Key:  key,
+              Action: "FINISHED",
+  						Type: "Job",
+  					})
+  				}
   			} else {
   				runtime.HandleError(err)
   				return
@@ -101,13 +138,9 @@ func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interfac
   		},
 	  })
 
-    wfListwatch := cache.NewListWatchFromClient(wfClientset.ArgoprojV1alpha1().RESTClient(), "workflows", metav1.NamespaceAll, fields.Everything())
-    wfInformer := cache.NewSharedIndexInformer(
-  		wfListwatch,
-  		&argo.Workflow{},
-  		resyncPeriod,
-  		cache.Indexers{},
-  	)
+    wfInformer := newNamespacedInformer(namespaces, func(namespace string) cache.ListerWatcher {
+      return cache.NewFilteredListWatchFromClient(wfClientset.ArgoprojV1alpha1().RESTClient(), "workflows", namespace, selectLabels)
+    }, &argo.Workflow{})
     wfInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
       AddFunc: func(obj interface{}) {
         key, err := cache.MetaNamespaceKeyFunc(obj)
@@ -136,6 +169,13 @@ func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interfac
   						Type: "Workflow",
   					})
   				}
+  				if wf.ObjectMeta.Labels[GitHookUIDLabel] != "" && !old.(*argo.Workflow).Status.Completed() && wf.Status.Completed() {
+  					queue.Add(Task{
+  						Key:  key,
+              Action: "FINISHED",
+  						Type: "Workflow",
+  					})
+  				}
   			} else {
   				runtime.HandleError(err)
   				return
@@ -143,13 +183,37 @@ func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interfac
   		},
 	  })
 
-    ghListwatch := cache.NewListWatchFromClient(ghClientset.KubegitV1alpha1().RESTClient(), "githooks", metav1.NamespaceAll, fields.Everything())
-    ghInformer := cache.NewSharedIndexInformer(
-  		ghListwatch,
-  		&ghapi.GitHook{},
-  		resyncPeriod,
-  		cache.Indexers{},
-  	)
+    ghFactories, ghInformer, ghListers := newGitHookInformer(ghClientset, namespaces)
+    ghInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+      AddFunc: func(obj interface{}) {
+        key, err := cache.MetaNamespaceKeyFunc(obj)
+        if err != nil {
+          runtime.HandleError(err)
+          return
+        }
+        if gitHookNeedsSync(obj.(*ghapi.GitHook)) {
+          queue.Add(Task{Key: key, Action: "SYNC", Type: "GitHook"})
+        }
+      },
+      UpdateFunc: func(old, new interface{}) {
+        key, err := cache.MetaNamespaceKeyFunc(new)
+        if err != nil {
+          runtime.HandleError(err)
+          return
+        }
+        if gitHookNeedsSync(new.(*ghapi.GitHook)) {
+          queue.Add(Task{Key: key, Action: "SYNC", Type: "GitHook"})
+        }
+      },
+    })
+
+    var prInformer, trInformer namespacedInformer
+    if _, err := clientset.Discovery().ServerResourcesForGroupVersion(PipelineRunResource.GroupVersion().String()); err == nil {
+      prInformer = newTektonInformer(dynClientset, PipelineRunResource, "PipelineRun", queue, namespaces, labelSelector)
+      trInformer = newTektonInformer(dynClientset, TaskRunResource, "TaskRun", queue, namespaces, labelSelector)
+    } else {
+      klog.Infof("Tekton %s is not available, PipelineRuns and TaskRuns will not be watched: %v", PipelineRunResource.GroupVersion().String(), err)
+    }
 
   	return &Controller{
       clientset: clientset,
@@ -157,22 +221,35 @@ func NewController(clientset kubernetes.Interface, wfClientset wfclient.Interfac
       wfClientset: wfClientset,
       wfInformer: wfInformer,
   		ghClientset: ghClientset,
+      ghFactories: ghFactories,
       ghInformer: ghInformer,
+      ghListers: ghListers,
+      dynClientset: dynClientset,
+      prInformer: prInformer,
+      trInformer: trInformer,
+      namespaces: namespaces,
       queue: queue,
       notification: notificationConfig,
   	}
 }
 
-func (c *Controller) Run(threadiness int, stopCh chan struct{}) error {
+// Start starts the informers and waits for their caches to sync. It runs on
+// every replica as the webhook reads the GitHooks from the informer cache.
+func (c *Controller) Start(stopCh chan struct{}) error {
 
   defer runtime.HandleCrash()
-	//defer c.queue.ShutDown()
 
-  klog.Info("Starting kube-git controller")
+  klog.Info("Starting kube-git informers")
 
   go c.jobInformer.Run(stopCh)
   go c.wfInformer.Run(stopCh)
-  go c.ghInformer.Run(stopCh)
+  for _, factory := range c.ghFactories {
+    factory.Start(stopCh)
+  }
+  if c.prInformer != nil {
+    go c.prInformer.Run(stopCh)
+    go c.trInformer.Run(stopCh)
+  }
 
 	klog.Info("Waiting for caches to sync")
   if ok := cache.WaitForCacheSync(stopCh, c.jobInformer.HasSynced); !ok {
@@ -184,14 +261,71 @@ func (c *Controller) Run(threadiness int, stopCh chan struct{}) error {
   if ok := cache.WaitForCacheSync(stopCh, c.ghInformer.HasSynced); !ok {
 		return fmt.Errorf("failed to wait for githooks caches to sync")
 	}
+  if c.prInformer != nil {
+    if ok := cache.WaitForCacheSync(stopCh, c.prInformer.HasSynced, c.trInformer.HasSynced); !ok {
+      return fmt.Errorf("failed to wait for tekton caches to sync")
+    }
+  }
+
+  return nil
+}
+
+// HasSynced is true once the caches of the informers are synced
+func (c *Controller) HasSynced() bool {
+  synced := c.jobInformer.HasSynced() && c.wfInformer.HasSynced() && c.ghInformer.HasSynced()
+  if c.prInformer != nil {
+    synced = synced && c.prInformer.HasSynced() && c.trInformer.HasSynced()
+  }
+  return synced
+}
+
+// Run starts the workers sending the notifications and patching the
+// annotations of the applied resources. With leader election it only runs on
+// the leader, the informers of the other replicas don't queue the resources
+// and the new leader queues the resources of its caches when it starts.
+// Closing stopCh shuts down the queue.
+func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) {
+
+  defer runtime.HandleCrash()
+
+  c.queue.setLeading()
+  c.queueCached()
 
   klog.Info("Starting workers")
 	// Launch two workers to process Foo resources
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		c.workers.Add(1)
+		go func() {
+			defer c.workers.Done()
+			c.runWorker()
+		}()
 	}
 
-  return nil
+	go func() {
+		<-stopCh
+		c.queue.ShutDown()
+	}()
+}
+
+// Shutdown shuts down the queue and waits for the workers to process the
+// queued resources, so their notifications aren't lost, until ctx is done.
+func (c *Controller) Shutdown(ctx context.Context) error {
+
+  klog.Info("Shutting down workers")
+  c.queue.ShutDown()
+
+  done := make(chan struct{})
+  go func() {
+    c.workers.Wait()
+    close(done)
+  }()
+
+  select {
+  case <-done:
+    return nil
+  case <-ctx.Done():
+    return fmt.Errorf("%d queued resources not processed: %s", c.queue.Len(), ctx.Err())
+  }
 }
 
 // runWorker is a long-running function that will continually call the
@@ -231,6 +365,13 @@ func (c *Controller) processNext() bool {
 
 func (c *Controller) process(task Task) error {
 
+  if task.Action == "FINISHED" {
+    return c.finished(task)
+  }
+  if task.Type == "GitHook" {
+    return c.syncGitHook(task)
+  }
+
   if task.Type == "Job" {
 
     obj, exists, err := c.jobInformer.GetIndexer().GetByKey(task.Key)
@@ -277,21 +418,89 @@ func (c *Controller) process(task Task) error {
       }
     }
 
+  } else if task.Type == "PipelineRun" || task.Type == "TaskRun" {
+
+    informer, resource := c.prInformer, PipelineRunResource
+    if task.Type == "TaskRun" {
+      informer, resource = c.trInformer, TaskRunResource
+    }
+    obj, exists, err := informer.GetIndexer().GetByKey(task.Key)
+  	if err != nil {
+  		return fmt.Errorf("failed to retrieve %s by key %q: %v", resource.Resource, task.Key, err)
+  	}
+    if exists {
+      run := obj.(*unstructured.Unstructured)
+      kind := "Tekton " + task.Type
+      if task.Action == "CREATE" {
+        c.notification.Notify("STARTED", kind, run.GetNamespace(), run.GetName(), run.GetAnnotations())
+        return c.tektonRemoveStarted(resource, run.GetNamespace(), run.GetName())
+      } else {
+        switch tektonSucceeded(run) {
+        case "False":
+          c.notification.Notify("FAILED", kind, run.GetNamespace(), run.GetName(), run.GetAnnotations())
+          return c.tektonRemoveNotification(resource, run.GetNamespace(), run.GetName(), run.GetAnnotations())
+        case "True":
+          c.notification.Notify("SUCCEEDED", kind, run.GetNamespace(), run.GetName(), run.GetAnnotations())
+          return c.tektonRemoveNotification(resource, run.GetNamespace(), run.GetName(), run.GetAnnotations())
+        }
+      }
+    }
+
   }
 
 	return nil
 
 }
 
+// GetGitHooks returns all the GitHooks of the informer cache
 func (c *Controller) GetGitHooks() []*ghapi.GitHook {
-  ghObjects := c.ghInformer.GetIndexer().List()
   var ghs []*ghapi.GitHook
-  for _, gh := range ghObjects {
-    ghs = append(ghs, gh.(*ghapi.GitHook))
+  for _, lister := range c.ghListers {
+    list, err := lister.List(labels.Everything())
+    if err != nil {
+      runtime.HandleError(err)
+      continue
+    }
+    ghs = append(ghs, list...)
   }
 	return ghs
 }
 
+// GetGitHooksByRepository returns the GitHooks of the informer cache whose
+// repository is one of urls, the SSH and HTTPS URLs of a repository are the
+// same repository
+func (c *Controller) GetGitHooksByRepository(urls ...string) []*ghapi.GitHook {
+  var ghs []*ghapi.GitHook
+  seen := make(map[string]bool)
+  for _, url := range urls {
+    repository := git.NormalizeURL(url)
+    if seen[repository] {
+      continue
+    }
+    seen[repository] = true
+    objs, err := c.ghInformer.GetIndexer().ByIndex(repositoryIndex, repository)
+    if err != nil {
+      runtime.HandleError(err)
+      continue
+    }
+    for _, obj := range objs {
+      ghs = append(ghs, obj.(*ghapi.GitHook))
+    }
+  }
+	return ghs
+}
+
+// GetGitHook returns the GitHook namespace/name of the informer cache
+func (c *Controller) GetGitHook(namespace string, name string) (*ghapi.GitHook, bool) {
+  for _, lister := range c.ghListers {
+    gh, err := lister.GitHooks(namespace).Get(name)
+    if err == nil {
+      return gh, true
+    }
+  }
+	return nil, false
+}
+
 func (c *Controller) jobRemoveNotification(ns string, job string, annotations map[string]string) error {
 	payloadBytes, _ := json.Marshal(notification.NewRemoveNotificationPatch(annotations))
 	_, err := c.clientset.BatchV1().Jobs(ns).Patch(job, types.JSONPatchType, payloadBytes)
@@ -315,3 +524,91 @@ func (c *Controller) wfRemoveStarted(ns string, wf string) error {
 	_, err := c.wfClientset.ArgoprojV1alpha1().Workflows(ns).Patch(wf, types.JSONPatchType, payloadBytes)
 	return err
 }
+
+func (c *Controller) tektonRemoveNotification(resource schema.GroupVersionResource, ns string, name string, annotations map[string]string) error {
+	payloadBytes, _ := json.Marshal(notification.NewRemoveNotificationPatch(annotations))
+	_, err := c.dynClientset.Resource(resource).Namespace(ns).Patch(name, types.JSONPatchType, payloadBytes, metav1.PatchOptions{})
+	return err
+}
+
+func (c *Controller) tektonRemoveStarted(resource schema.GroupVersionResource, ns string, name string) error {
+	payloadBytes, _ := json.Marshal(notification.NewRemoveStartedPatch())
+	_, err := c.dynClientset.Resource(resource).Namespace(ns).Patch(name, types.JSONPatchType, payloadBytes, metav1.PatchOptions{})
+	return err
+}
+
+// newTektonInformer builds an informer of PipelineRuns or TaskRuns that queues
+// the runs annotated for notification, the same way Jobs and Workflows are.
+func newTektonInformer(dynClientset dynamic.Interface, resource schema.GroupVersionResource, kind string, queue workqueue.RateLimitingInterface, namespaces []string, labelSelector string) namespacedInformer {
+	informer := newNamespacedInformer(namespaces, func(namespace string) cache.ListerWatcher {
+		return &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (k8sruntime.Object, error) {
+				options.LabelSelector = labelSelector
+				return dynClientset.Resource(resource).Namespace(namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = labelSelector
+				return dynClientset.Resource(resource).Namespace(namespace).Watch(options)
+			},
+		}
+	}, &unstructured.Unstructured{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err == nil {
+				run := obj.(*unstructured.Unstructured)
+				if notification.ShouldNotifyStarted(run.GetAnnotations()) {
+					queue.AddRateLimited(Task{
+						Key:    key,
+						Action: "CREATE",
+						Type:   kind,
+					})
+				}
+			} else {
+				runtime.HandleError(err)
+				return
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(new)
+			if err == nil {
+				run := new.(*unstructured.Unstructured)
+				if notification.ShouldNotify(run.GetAnnotations()) {
+					queue.AddRateLimited(Task{
+						Key:    key,
+						Action: "UPDATE",
+						Type:   kind,
+					})
+				}
+				if run.GetLabels()[GitHookUIDLabel] != "" && !tektonFinished(old.(*unstructured.Unstructured)) && tektonFinished(run) {
+					queue.Add(Task{
+						Key:    key,
+						Action: "FINISHED",
+						Type:   kind,
+					})
+				}
+			} else {
+				runtime.HandleError(err)
+				return
+			}
+		},
+	})
+	return informer
+}
+
+// tektonSucceeded returns the status ("True", "False" or "Unknown") of the
+// Succeeded condition of a PipelineRun or TaskRun, or "" if it is not set yet.
+func tektonSucceeded(run *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(run.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Succeeded" {
+			status, _ := condition["status"].(string)
+			return status
+		}
+	}
+	return ""
+}
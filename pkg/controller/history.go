@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	argo "github.com/argoproj/argo/pkg/apis/workflow/v1alpha1"
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/metrics"
+)
+
+// GitHookUIDLabel is set to the UID of the GitHook on the resources it creates,
+// a label value can't hold the namespace/name of the GitHook
+const GitHookUIDLabel = "kubegit.appspero.com/githook-uid"
+
+// run is a resource created by a GitHook
+type run struct {
+	name      string
+	namespace string
+	created   metav1.Time
+	finished  bool
+	succeeded bool
+}
+
+// finished records the outcome of the finished resource of the task and prunes
+// the runs of its GitHook
+func (c *Controller) finished(task Task) error {
+
+	informer := c.jobInformer
+	switch task.Type {
+	case "Workflow":
+		informer = c.wfInformer
+	case "PipelineRun":
+		informer = c.prInformer
+	case "TaskRun":
+		informer = c.trInformer
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(task.Key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s by key %q: %v", task.Type, task.Key, err)
+	}
+	if !exists {
+		return nil
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if parts := strings.SplitN(m.GetAnnotations()["kubegit.appspero.com/githook"], "/", 2); len(parts) == 2 {
+		metrics.Runs.WithLabelValues(parts[0], parts[1], task.Type, runOutcome(obj)).Inc()
+	}
+	c.pruneRuns(task.Type, m.GetNamespace(), m.GetLabels(), m.GetAnnotations())
+	return nil
+}
+
+// runOutcome is "succeeded" or "failed" for a finished Job, Workflow or Tekton run
+func runOutcome(obj interface{}) string {
+	succeeded := false
+	switch run := obj.(type) {
+	case *batch.Job:
+		for _, condition := range run.Status.Conditions {
+			if condition.Type == batch.JobComplete && condition.Status == corev1.ConditionTrue {
+				succeeded = true
+			}
+		}
+	case *argo.Workflow:
+		succeeded = run.Status.Phase == "Succeeded"
+	case *unstructured.Unstructured:
+		succeeded = tektonSucceeded(run) == "True"
+	}
+	if succeeded {
+		return "succeeded"
+	}
+	return "failed"
+}
+
+// pruneRuns deletes the oldest finished resources of kind created by the
+// GitHook of the resource above the history limits of the GitHook
+func (c *Controller) pruneRuns(kind string, namespace string, labels map[string]string, annotations map[string]string) {
+
+	uid := labels[GitHookUIDLabel]
+	parts := strings.SplitN(annotations["kubegit.appspero.com/githook"], "/", 2)
+	if uid == "" || len(parts) != 2 {
+		return
+	}
+	gh, ok := c.GetGitHook(parts[0], parts[1])
+	if !ok || string(gh.UID) != uid {
+		return
+	}
+	if gh.Spec.SuccessfulRunsHistoryLimit == nil && gh.Spec.FailedRunsHistoryLimit == nil {
+		return
+	}
+
+	runs, err := c.listRuns(kind, namespace, metav1.ListOptions{LabelSelector: GitHookUIDLabel + "=" + uid})
+	if err != nil {
+		klog.Errorf("Error listing %ss of GitHook %s/%s: %s", kind, gh.Namespace, gh.Name, err.Error())
+		return
+	}
+
+	// newest first
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[j].created.Before(&runs[i].created)
+	})
+
+	succeeded, failed := 0, 0
+	for _, r := range runs {
+		if !r.finished {
+			continue
+		}
+		limit := gh.Spec.FailedRunsHistoryLimit
+		count := &failed
+		if r.succeeded {
+			limit = gh.Spec.SuccessfulRunsHistoryLimit
+			count = &succeeded
+		}
+		*count++
+		if limit == nil || int32(*count) <= *limit {
+			continue
+		}
+		klog.Infof("Deleting %s %s/%s above the history limit of GitHook %s/%s", kind, namespace, r.name, gh.Namespace, gh.Name)
+		if err := c.deleteRun(kind, namespace, r.name); err != nil {
+			klog.Errorf("Error deleting %s %s/%s: %s", kind, namespace, r.name, err.Error())
+		}
+	}
+}
+
+// listRuns returns the resources of kind in namespace matching opts
+func (c *Controller) listRuns(kind string, namespace string, opts metav1.ListOptions) ([]run, error) {
+
+	var runs []run
+	switch kind {
+	case "Job":
+		list, err := c.clientset.BatchV1().Jobs(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range list.Items {
+			r := run{name: job.Name, namespace: job.Namespace, created: job.CreationTimestamp}
+			for _, condition := range job.Status.Conditions {
+				if (condition.Type == batch.JobComplete || condition.Type == batch.JobFailed) && condition.Status == corev1.ConditionTrue {
+					r.finished = true
+					r.succeeded = condition.Type == batch.JobComplete
+				}
+			}
+			runs = append(runs, r)
+		}
+
+	case "Workflow":
+		list, err := c.wfClientset.ArgoprojV1alpha1().Workflows(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, wf := range list.Items {
+			runs = append(runs, run{
+				name:      wf.Name,
+				namespace: wf.Namespace,
+				created:   wf.CreationTimestamp,
+				finished:  wf.Status.Completed(),
+				succeeded: wf.Status.Phase == "Succeeded",
+			})
+		}
+
+	case "PipelineRun", "TaskRun":
+		resource := PipelineRunResource
+		if kind == "TaskRun" {
+			resource = TaskRunResource
+		}
+		list, err := c.dynClientset.Resource(resource).Namespace(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			status := tektonSucceeded(&list.Items[i])
+			runs = append(runs, run{
+				name:      list.Items[i].GetName(),
+				namespace: list.Items[i].GetNamespace(),
+				created:   list.Items[i].GetCreationTimestamp(),
+				finished:  status == "True" || status == "False",
+				succeeded: status == "True",
+			})
+		}
+	}
+	return runs, nil
+}
+
+func jobFinished(job *batch.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batch.JobComplete || condition.Type == batch.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func tektonFinished(run *unstructured.Unstructured) bool {
+	status := tektonSucceeded(run)
+	return status == "True" || status == "False"
+}
+
+func (c *Controller) deleteRun(kind string, namespace string, name string) error {
+
+	// delete the pods of the Jobs too
+	propagation := metav1.DeletePropagationBackground
+	opts := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	switch kind {
+	case "Job":
+		return c.clientset.BatchV1().Jobs(namespace).Delete(name, opts)
+	case "Workflow":
+		return c.wfClientset.ArgoprojV1alpha1().Workflows(namespace).Delete(name, opts)
+	case "PipelineRun":
+		return c.dynClientset.Resource(PipelineRunResource).Namespace(namespace).Delete(name, opts)
+	case "TaskRun":
+		return c.dynClientset.Resource(TaskRunResource).Namespace(namespace).Delete(name, opts)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	ghclient "github.com/appspero/kube-git/pkg/client/clientset/versioned"
+	ghinformers "github.com/appspero/kube-git/pkg/client/informers/externalversions"
+	ghlisters "github.com/appspero/kube-git/pkg/client/listers/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/git"
+)
+
+// repositoryIndex indexes the GitHooks by the normalized URL of their repository
+const repositoryIndex = "repository"
+
+// namespacedInformer is an informer of a resource for each watched namespace,
+// or a single informer of all the namespaces, so a namespace-scoped install
+// only needs a Role in the watched namespaces
+type namespacedInformer []cache.SharedIndexInformer
+
+// newNamespacedInformer builds the informers of objType in namespaces, all the
+// namespaces if empty
+func newNamespacedInformer(namespaces []string, listWatch func(namespace string) cache.ListerWatcher, objType k8sruntime.Object) namespacedInformer {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var informer namespacedInformer
+	for _, namespace := range namespaces {
+		informer = append(informer, cache.NewSharedIndexInformer(
+			listWatch(namespace),
+			objType,
+			resyncPeriod,
+			cache.Indexers{},
+		))
+	}
+	return informer
+}
+
+// newGitHookInformer builds the GitHook informers of namespaces, all the
+// namespaces if empty, with the shared informer factories of pkg/client. The
+// factories must be started, and the listers read their caches.
+func newGitHookInformer(ghClientset ghclient.Interface, namespaces []string) ([]ghinformers.SharedInformerFactory, namespacedInformer, []ghlisters.GitHookLister) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var factories []ghinformers.SharedInformerFactory
+	var informer namespacedInformer
+	var listers []ghlisters.GitHookLister
+	for _, namespace := range namespaces {
+		factory := ghinformers.NewSharedInformerFactoryWithOptions(ghClientset, resyncPeriod, ghinformers.WithNamespace(namespace))
+		ghInformer := factory.Kubegit().V1beta1().GitHooks()
+		if err := ghInformer.Informer().AddIndexers(cache.Indexers{repositoryIndex: gitHookRepository}); err != nil {
+			runtime.HandleError(err)
+		}
+		factories = append(factories, factory)
+		informer = append(informer, ghInformer.Informer())
+		listers = append(listers, ghInformer.Lister())
+	}
+	return factories, informer, listers
+}
+
+// gitHookRepository is the index function of repositoryIndex
+func gitHookRepository(obj interface{}) ([]string, error) {
+	gh, ok := obj.(*ghapi.GitHook)
+	if !ok {
+		return nil, fmt.Errorf("expected a GitHook, got %T", obj)
+	}
+	return []string{git.NormalizeURL(gh.Spec.Repository)}, nil
+}
+
+func (n namespacedInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	for _, informer := range n {
+		informer.AddEventHandler(handler)
+	}
+}
+
+// Run runs the informers until stopCh is closed
+func (n namespacedInformer) Run(stopCh <-chan struct{}) {
+	for _, informer := range n {
+		go informer.Run(stopCh)
+	}
+	<-stopCh
+}
+
+func (n namespacedInformer) HasSynced() bool {
+	for _, informer := range n {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n namespacedInformer) GetIndexer() namespacedIndexer {
+	var indexer namespacedIndexer
+	for _, informer := range n {
+		indexer = append(indexer, informer.GetIndexer())
+	}
+	return indexer
+}
+
+// namespacedIndexer reads the caches of the informers of each namespace
+type namespacedIndexer []cache.Indexer
+
+func (n namespacedIndexer) GetByKey(key string) (interface{}, bool, error) {
+	for _, indexer := range n {
+		obj, exists, err := indexer.GetByKey(key)
+		if err != nil || exists {
+			return obj, exists, err
+		}
+	}
+	return nil, false, nil
+}
+
+// ByIndex returns the objects of the caches of each namespace whose indexName
+// index is value
+func (n namespacedIndexer) ByIndex(indexName string, value string) ([]interface{}, error) {
+	var objs []interface{}
+	for _, indexer := range n {
+		list, err := indexer.ByIndex(indexName, value)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, list...)
+	}
+	return objs, nil
+}
+
+// List returns the objects of the caches of each namespace
+func (n namespacedIndexer) List() []interface{} {
+	var objs []interface{}
+	for _, indexer := range n {
+		objs = append(objs, indexer.List()...)
+	}
+	return objs
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/notification"
+)
+
+// leaderQueue drops the tasks queued by the informers while the replica isn't
+// leading, as no worker processes them. The leader queues the resources of the
+// informer caches when it starts leading instead.
+type leaderQueue struct {
+	workqueue.RateLimitingInterface
+	leading int32
+}
+
+func (q *leaderQueue) setLeading() {
+	atomic.StoreInt32(&q.leading, 1)
+}
+
+func (q *leaderQueue) isLeading() bool {
+	return atomic.LoadInt32(&q.leading) == 1
+}
+
+func (q *leaderQueue) Add(item interface{}) {
+	if q.isLeading() {
+		q.RateLimitingInterface.Add(item)
+	}
+}
+
+func (q *leaderQueue) AddRateLimited(item interface{}) {
+	if q.isLeading() {
+		q.RateLimitingInterface.AddRateLimited(item)
+	}
+}
+
+// queueCached queues the resources of the informer caches the informers of a
+// follower didn't queue: the notifications and the GitHooks to sync
+func (c *Controller) queueCached() {
+
+	queueRuns := func(informer namespacedInformer, kind string) {
+		if informer == nil {
+			return
+		}
+		for _, obj := range informer.GetIndexer().List() {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				runtime.HandleError(err)
+				continue
+			}
+			m, err := meta.Accessor(obj)
+			if err != nil {
+				runtime.HandleError(err)
+				continue
+			}
+			if notification.ShouldNotifyStarted(m.GetAnnotations()) {
+				c.queue.Add(Task{Key: key, Action: "CREATE", Type: kind})
+			}
+			if notification.ShouldNotify(m.GetAnnotations()) {
+				c.queue.Add(Task{Key: key, Action: "UPDATE", Type: kind})
+			}
+		}
+	}
+	queueRuns(c.jobInformer, "Job")
+	queueRuns(c.wfInformer, "Workflow")
+	queueRuns(c.prInformer, "PipelineRun")
+	queueRuns(c.trInformer, "TaskRun")
+
+	for _, obj := range c.ghInformer.GetIndexer().List() {
+		gh := obj.(*ghapi.GitHook)
+		if gitHookNeedsSync(gh) {
+			c.queue.Add(Task{Key: gh.Namespace + "/" + gh.Name, Action: "SYNC", Type: "GitHook"})
+		}
+	}
+
+	klog.Infof("Queued %d cached resources", c.queue.Len())
+}
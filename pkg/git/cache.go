@@ -0,0 +1,275 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+
+	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/metrics"
+)
+
+// RepositoryCache keeps bare mirrors of repositories in a directory (a PVC or
+// an emptyDir) so every push only fetches the new objects of the branch instead
+// of cloning the repository again. The mirrors are keyed by repository URL and
+// credentials, so a commit fetched with the credentials of one GitHook is never
+// served to a GitHook without them. Access to a mirror is serialised, and the
+// least recently used mirrors are evicted when the cache exceeds its size or
+// repository limits.
+type RepositoryCache struct {
+	dir             string
+	maxSize         int64
+	maxRepositories int
+
+	mu    sync.Mutex
+	repos map[string]*cachedRepository
+}
+
+type cachedRepository struct {
+	// mu serialises fetches and reads of the mirror
+	mu       sync.Mutex
+	dir      string
+	lastUsed time.Time
+	size     int64
+	// inUse counts the callers holding or waiting for mu, a mirror in use is never evicted
+	inUse int
+}
+
+// NewRepositoryCache creates the cache in dir, picking up the mirrors left by a
+// previous run. A maxSize (bytes) or maxRepositories of 0 means no limit.
+func NewRepositoryCache(dir string, maxSize int64, maxRepositories int) (*RepositoryCache, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &RepositoryCache{
+		dir:             dir,
+		maxSize:         maxSize,
+		maxRepositories: maxRepositories,
+		repos:           make(map[string]*cachedRepository),
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		repoDir := filepath.Join(dir, e.Name())
+		c.repos[e.Name()] = &cachedRepository{
+			dir:      repoDir,
+			lastUsed: e.ModTime(),
+			size:     dirSize(repoDir),
+		}
+	}
+	klog.Infof("Repository cache at %s has %d repositories", dir, len(c.repos))
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// FetchGitFile reads the manifest file from the commit hash of the repository
+// like FetchGitFile, using the mirror of the repository and fetching the
+// branch into it only if the commit isn't in the mirror yet.
+func (c *RepositoryCache) FetchGitFile(repository string, branch string, a Auth, hash string, manifest string, opts FetchOptions) ([]byte, error) {
+	return fetchManifest(c.fetchGitFile, repository, branch, a, hash, manifest, opts)
+}
+
+// VerifyCommit verifies the signature of the commit hash like VerifyCommit,
+// using the mirror of the repository.
+func (c *RepositoryCache) VerifyCommit(repository string, branch string, a Auth, hash string, keys []string) error {
+	_, err := c.fetchGitFile(repository, branch, a, hash, "", keys)
+	return err
+}
+
+func (c *RepositoryCache) fetchGitFile(repository string, branch string, a Auth, hash string, manifest string, keys []string) (b []byte, err error) {
+
+	auth, verifier, err := newAuth(repository, a)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = verifier.wrap(err)
+	}()
+
+	r := c.acquire(repository, a)
+	defer c.release(r)
+
+	created, fetched := false, false
+	defer func() {
+		// don't keep a mirror that was never fetched successfully
+		if created && !fetched {
+			os.RemoveAll(r.dir)
+		}
+	}()
+
+	s := filesystem.NewStorage(osfs.New(r.dir), cache.NewObjectLRUDefault())
+	repo, err := git.Open(s, nil)
+	if err == git.ErrRepositoryNotExists {
+		created = true
+		metrics.RepositoryCacheMisses.Inc()
+		klog.Infof("Creating mirror of %s in repository cache", repository)
+		repo, err = git.Init(s, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, err = repo.CreateRemote(&config.RemoteConfig{
+			Name: git.DefaultRemoteName,
+			URLs: []string{repository},
+		})
+	} else if err == nil {
+		metrics.RepositoryCacheHits.Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := plumbing.NewHash(hash)
+	if _, err = object.GetCommit(s, h); err != nil {
+		refSpec := config.RefSpec("+" + branch + ":" + branch)
+		if branch == "" {
+			// submodule without branch, the commit can be on any branch
+			refSpec = "+refs/heads/*:refs/heads/*"
+		}
+		klog.Infof("Fetching %s of %s into repository cache", refSpec, repository)
+		size := dirSize(r.dir)
+		start := time.Now()
+		err = repo.Fetch(&git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			RefSpecs:   []config.RefSpec{refSpec},
+			Auth:       auth,
+			Tags:       git.NoTags,
+		})
+		if err == git.NoErrAlreadyUpToDate {
+			err = nil
+		}
+		metrics.FetchDuration.WithLabelValues("cache", metrics.Result(err)).Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+		if grown := dirSize(r.dir) - size; grown > 0 {
+			metrics.FetchBytes.WithLabelValues("cache").Add(float64(grown))
+		}
+	}
+	fetched = true
+
+	return readFile(s, h, manifest, keys)
+}
+
+func (c *RepositoryCache) acquire(repository string, a Auth) *cachedRepository {
+	c.mu.Lock()
+	name := mirrorName(repository, a)
+
+	r, ok := c.repos[name]
+	if !ok {
+		r = &cachedRepository{dir: filepath.Join(c.dir, name)}
+		c.repos[name] = r
+	}
+	r.inUse++
+	c.mu.Unlock()
+
+	r.mu.Lock()
+	return r
+}
+
+func (c *RepositoryCache) release(r *cachedRepository) {
+	size := dirSize(r.dir)
+	now := time.Now()
+	os.Chtimes(r.dir, now, now)
+	r.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.inUse--
+	r.lastUsed = now
+	r.size = size
+	if _, err := os.Stat(r.dir); os.IsNotExist(err) && r.inUse == 0 {
+		delete(c.repos, filepath.Base(r.dir))
+	}
+	c.evict()
+}
+
+// evict removes the least recently used mirrors until the cache is within its
+// limits. c.mu must be held.
+func (c *RepositoryCache) evict() {
+
+	var names []string
+	var total int64
+	for name, r := range c.repos {
+		names = append(names, name)
+		total += r.size
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.repos[names[i]].lastUsed.Before(c.repos[names[j]].lastUsed)
+	})
+
+	count := len(names)
+	for _, name := range names {
+		overSize := c.maxSize > 0 && total > c.maxSize
+		overCount := c.maxRepositories > 0 && count > c.maxRepositories
+		if !overSize && !overCount {
+			break
+		}
+		r := c.repos[name]
+		if r.inUse > 0 {
+			continue
+		}
+		klog.Infof("Evicting %s from repository cache", r.dir)
+		if err := os.RemoveAll(r.dir); err != nil {
+			klog.Errorf("Error evicting %s from repository cache: %s", r.dir, err)
+			continue
+		}
+		delete(c.repos, name)
+		total -= r.size
+		count--
+		metrics.RepositoryCacheEvictions.Inc()
+	}
+
+	metrics.RepositoryCacheSize.Set(float64(total))
+	metrics.RepositoryCacheRepositories.Set(float64(count))
+}
+
+// mirrorName is the directory name of the mirror of the repository fetched
+// with the credentials a. Anonymous fetches share a mirror per repository.
+func mirrorName(repository string, a Auth) string {
+	h := sha256.New()
+	h.Write([]byte(repository))
+	for _, b := range [][]byte{a.Username, a.Password, a.SshPrivateKey, a.SshPassphrase, []byte(a.SshUser)} {
+		// length prefix so the fields can't run into each other
+		fmt.Fprintf(h, "\x00%d:", len(b))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,56 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/tools"
+)
+
+// FetchGithubFile reads the manifest file from the commit hash of a GitHub
+// repository with the contents API, without using git at all. The token is
+// optional for public repositories.
+func FetchGithubFile(api string, repository string, token []byte, hash string, manifest string) ([]byte, error) {
+
+	owner, repo := tools.ParseGithubRepository(repository)
+	if owner == "" || repo == "" {
+		return nil, fmt.Errorf("Could't parse GitHub repository or owner: %s", repository)
+	}
+
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", strings.TrimSuffix(api, "/"), owner, repo, strings.TrimPrefix(manifest, "/"), url.QueryEscape(hash))
+
+	klog.Infof("Fetching %s of revision %s from GitHub API: %s", manifest, hash, apiURL)
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3.raw")
+	if len(token) != 0 {
+		req.Header.Set("Authorization", "token "+string(token))
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub contents API returned %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -1,93 +1,342 @@
 package git
 
 import (
-	"os"
-	"os/exec"
-	"path/filepath"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 
+	"gopkg.in/src-d/go-billy.v4/osfs"
 	git "gopkg.in/src-d/go-git.v4"
-	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 
 	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/metrics"
 )
 
-func FetchGitFile(repository string, branch string, username []byte, password []byte, key []byte, hash string, manifest string) ([]byte, error) {
+// Auth is the credentials used to fetch a repository
+type Auth struct {
+	Username []byte
+	Password []byte
+
+	SshPrivateKey []byte
+	// SshPassphrase decrypts SshPrivateKey if it is encrypted
+	SshPassphrase []byte
+	// SshUser is the SSH user, default is the user of the repository URL or "git"
+	SshUser string
+	// KnownHosts is the content of a known_hosts file used to verify the host
+	// key of the SSH server
+	KnownHosts []byte
+	// InsecureIgnoreHostKey skips the verification of the host key when no
+	// known hosts are configured, instead of failing the fetch
+	InsecureIgnoreHostKey bool
+}
+
+// HostKeyError is returned when the host key of the SSH server is unknown or
+// doesn't match the known hosts
+type HostKeyError struct {
+	Host string
+	Err  error
+}
 
-	var err error
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("host key verification of %s failed: %s", e.Host, e.Err)
+}
 
-	path, err := ioutil.TempDir("", hash)
+// FetchGitFile reads the manifest file from the commit hash of the repository.
+// Only the objects of that commit are fetched (depth 1) into a bare object
+// storage and the file is read from the commit tree, no worktree is checked out.
+// If the server doesn't allow fetching the commit by hash, the branch is cloned.
+func FetchGitFile(repository string, branch string, a Auth, hash string, manifest string, opts FetchOptions) ([]byte, error) {
+	return fetchManifest(fetchGitFile, repository, branch, a, hash, manifest, opts)
+}
+
+// VerifyCommit fetches the commit hash of the repository and verifies that it
+// is signed by one of the armored OpenPGP public keys, for GitHooks that don't
+// read their manifest from the repository.
+func VerifyCommit(repository string, branch string, a Auth, hash string, keys []string) error {
+	_, err := fetchGitFile(repository, branch, a, hash, "", keys)
+	return err
+}
+
+func fetchGitFile(repository string, branch string, a Auth, hash string, manifest string, keys []string) (b []byte, err error) {
+
+	auth, verifier, err := newAuth(repository, a)
 	if err != nil {
-		klog.Info(err)
+		return nil, err
 	}
+	defer func() {
+		err = verifier.wrap(err)
+	}()
 
-	defer os.RemoveAll(path) // clean up
-
-	if len(key) != 0 {
+	dir, err := ioutil.TempDir("", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir) // clean up
 
-		// future: ParsePrivateKeyWithPassphrase
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
+	s := filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	start := time.Now()
+	err = fetchCommit(s, repository, auth, plumbing.NewHash(hash))
+	metrics.FetchDuration.WithLabelValues("fetch", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		if verifier.err != nil {
 			return nil, err
 		}
-		// InsecureIgnoreHostKey should be replaced by adding hostkey to config
-		auth := &gitssh.PublicKeys{User: "git", Signer: signer}
-		auth.HostKeyCallbackHelper.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		klog.Infof("Fetching revision %s of %s failed, cloning branch %s: %s", hash, repository, branch, err)
 
-		_, err = git.PlainClone(path , false, &git.CloneOptions{
-	    URL: repository,
-			Auth: auth,
+		if err = os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		s = filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+		start = time.Now()
+		_, err = git.Clone(s, nil, &git.CloneOptions{
+			URL:           repository,
+			Auth:          auth,
 			ReferenceName: plumbing.ReferenceName(branch),
-			SingleBranch: true,
-			NoCheckout: true,
+			SingleBranch:  true,
+			NoCheckout:    true,
+			Tags:          git.NoTags,
 		})
+		metrics.FetchDuration.WithLabelValues("clone", metrics.Result(err)).Observe(time.Since(start).Seconds())
 		if err != nil {
 			return nil, err
 		}
+		metrics.FetchBytes.WithLabelValues("clone").Add(float64(dirSize(dir)))
+	}
 
-	} else if (len(username) != 0 || len(password) != 0) {
+	return readFile(s, plumbing.NewHash(hash), manifest, keys)
+}
 
-		auth := &http.BasicAuth{Username: string(username), Password: string(password)}
-		_, err = git.PlainClone(path , false, &git.CloneOptions{
-	    URL: repository,
-			Auth: auth,
-			ReferenceName: plumbing.ReferenceName(branch),
-			SingleBranch: true,
-			NoCheckout: true,
-		})
+func newAuth(repository string, a Auth) (transport.AuthMethod, *hostKeyVerifier, error) {
+
+	verifier := &hostKeyVerifier{}
+
+	if len(a.SshPrivateKey) != 0 {
+		signer, err := parsePrivateKey(a.SshPrivateKey, a.SshPassphrase)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-	} else {
+		user := a.SshUser
+		if user == "" {
+			user = gitssh.DefaultUsername
+			if ep, err := transport.NewEndpoint(repository); err == nil && ep.User != "" {
+				user = ep.User
+			}
+		}
 
-		_, err = git.PlainClone(path , false, &git.CloneOptions{
-	    URL: repository,
-			ReferenceName: plumbing.ReferenceName(branch),
-			SingleBranch: true,
-			NoCheckout: true,
-		})
-		if err != nil {
-			return nil, err
+		auth := &gitssh.PublicKeys{User: user, Signer: signer}
+		if len(bytes.TrimSpace(a.KnownHosts)) != 0 {
+			callback, err := newKnownHostsCallback(a.KnownHosts)
+			if err != nil {
+				return nil, nil, err
+			}
+			verifier.callback = callback
+			auth.HostKeyCallbackHelper.HostKeyCallback = verifier.verify
+		} else if a.InsecureIgnoreHostKey {
+			klog.Warning("No known hosts are configured, the SSH host key is not verified")
+			auth.HostKeyCallbackHelper.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		} else {
+			return nil, nil, fmt.Errorf("no known hosts are configured to verify the SSH host key of %s", repository)
 		}
+		return auth, verifier, nil
+	}
 
+	if len(a.Username) != 0 || len(a.Password) != 0 {
+		return &http.BasicAuth{Username: string(a.Username), Password: string(a.Password)}, verifier, nil
 	}
 
-	klog.Infof("Checking out revision %s", hash)
-	cmd := exec.Command("git", "checkout", hash)
-	cmd.Dir = path
-	_, err = cmd.Output()
+	return nil, verifier, nil
+}
+
+// parsePrivateKey parses RSA, ECDSA and ed25519 private keys in PEM, PKCS#8
+// or OpenSSH format, decrypting them with passphrase if they are encrypted
+func parsePrivateKey(key []byte, passphrase []byte) (ssh.Signer, error) {
+
+	if len(passphrase) == 0 {
+		signer, err := ssh.ParsePrivateKey(key)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			return nil, fmt.Errorf("the SSH private key is encrypted and no passphrase is configured: %s", err)
+		}
+		return signer, err
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err == x509.IncorrectPasswordError {
+		return nil, fmt.Errorf("the passphrase of the SSH private key is incorrect")
+	}
+	return signer, err
+}
+
+func newKnownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	// knownhosts only reads files
+	f, err := ioutil.TempFile("", "known_hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(knownHosts); err != nil {
+		return nil, err
+	}
+	return knownhosts.New(f.Name())
+}
+
+// hostKeyVerifier keeps the host key verification error, which is lost in
+// the SSH handshake error returned by go-git
+type hostKeyVerifier struct {
+	callback ssh.HostKeyCallback
+	err      *HostKeyError
+}
+
+func (v *hostKeyVerifier) verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := v.callback(hostname, remote, key)
+	if err != nil {
+		v.err = &HostKeyError{Host: hostname, Err: err}
+	}
+	return err
+}
+
+// wrap returns the host key verification error instead of err if there was one
+func (v *hostKeyVerifier) wrap(err error) error {
+	if err != nil && v != nil && v.err != nil {
+		return v.err
+	}
+	return err
+}
+
+// fetchCommit asks the server for the single commit hash with depth 1 and
+// stores the received packfile in s.
+func fetchCommit(s *filesystem.Storage, repository string, auth transport.AuthMethod, hash plumbing.Hash) (err error) {
+
+	ep, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return err
+	}
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return err
+	}
+	session, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Wants = []plumbing.Hash{hash}
+	req.Depth = packp.DepthCommits(1)
+	if err = req.Capabilities.Set(capability.Shallow); err != nil {
+		return err
+	}
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err = req.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+
+	klog.Infof("Fetching revision %s of %s", hash, repository)
+	resp, err := session.UploadPack(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	if err = packfile.UpdateObjectStorage(s, newPackReader(resp, req.Capabilities)); err != nil {
+		return err
+	}
+	return s.SetShallow(resp.Shallows)
+}
+
+// newPackReader reads the packfile of an upload-pack response, counting the
+// bytes fetched
+func newPackReader(resp io.Reader, caps *capability.List) io.Reader {
+	counted := &countingReader{r: resp, method: "fetch"}
+	if caps.Supports(capability.Sideband64k) {
+		return sideband.NewDemuxer(sideband.Sideband64k, counted)
+	} else if caps.Supports(capability.Sideband) {
+		return sideband.NewDemuxer(sideband.Sideband, counted)
+	}
+	return counted
+}
+
+// countingReader counts the bytes fetched by method in the metrics
+type countingReader struct {
+	r      io.Reader
+	method string
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	metrics.FetchBytes.WithLabelValues(c.method).Add(float64(n))
+	return n, err
+}
+
+// readFile reads a file from the tree of commit hash. If the file is in a
+// submodule, a *submoduleError is returned. If keys isn't empty, the commit is
+// verified first and nothing is read if manifest is empty.
+func readFile(s storer.EncodedObjectStorer, hash plumbing.Hash, manifest string, keys []string) ([]byte, error) {
+
+	commit, err := object.GetCommit(s, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) != 0 {
+		if err := verifyCommit(commit, keys); err != nil {
+			return nil, err
+		}
+	}
+	if manifest == "" {
+		return nil, nil
+	}
+
+	manifest = strings.TrimPrefix(path.Clean("/"+manifest), "/")
+	file, err := commit.File(manifest)
+	if err == object.ErrFileNotFound {
+		if err := findSubmodule(commit, manifest); err != nil {
+			return nil, err
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := ioutil.ReadFile(filepath.Join(path, manifest))
+	reader, err := file.Reader()
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	defer reader.Close()
 
+	return ioutil.ReadAll(reader)
 }
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+
+	"github.com/appspero/kube-git/pkg/metrics"
+)
+
+func TestNewPackReader(t *testing.T) {
+
+	fetched := func() float64 {
+		var m dto.Metric
+		if err := metrics.FetchBytes.WithLabelValues("fetch").Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	pack := []byte("PACK packfile content")
+
+	tests := []struct {
+		name     string
+		sideband capability.Capability
+	}{
+		{name: "no sideband"},
+		{name: "sideband", sideband: capability.Sideband},
+		{name: "sideband 64k", sideband: capability.Sideband64k},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			caps := capability.NewList()
+			resp := pack
+			if test.sideband != "" {
+				if err := caps.Set(test.sideband); err != nil {
+					t.Fatal(err)
+				}
+				typ := sideband.Sideband64k
+				if test.sideband == capability.Sideband {
+					typ = sideband.Sideband
+				}
+				var buf bytes.Buffer
+				if _, err := sideband.NewMuxer(typ, &buf).Write(pack); err != nil {
+					t.Fatal(err)
+				}
+				buf.WriteString("0000")
+				resp = buf.Bytes()
+			}
+
+			before := fetched()
+			b, err := ioutil.ReadAll(newPackReader(bytes.NewReader(resp), caps))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, pack) {
+				t.Errorf("got packfile %q, want %q", b, pack)
+			}
+			if got := fetched() - before; got != float64(len(resp)) {
+				t.Errorf("got %v fetched bytes, want %d", got, len(resp))
+			}
+		})
+	}
+}
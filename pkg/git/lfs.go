@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+
+	"k8s.io/klog"
+)
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	// pointer files are always smaller than this
+	lfsPointerMaxSize = 1024
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+var lfsClient = &http.Client{Timeout: 5 * time.Minute}
+
+// lfsPointer is the content of a Git LFS pointer file
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer returns the pointer if b is a Git LFS pointer file
+func parseLFSPointer(b []byte) (*lfsPointer, bool) {
+
+	if len(b) > lfsPointerMaxSize || !bytes.HasPrefix(b, []byte(lfsPointerVersion+"\n")) {
+		return nil, false
+	}
+
+	p := &lfsPointer{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "oid":
+			p.Oid = strings.TrimPrefix(fields[1], "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			p.Size = size
+		}
+	}
+	if len(p.Oid) != sha256.Size*2 {
+		return nil, false
+	}
+	return p, true
+}
+
+// readLFS returns b, or the LFS object if b is an LFS pointer and opts allow
+// downloading it.
+func readLFS(b []byte, repository string, a Auth, manifest string, opts FetchOptions) ([]byte, error) {
+
+	pointer, ok := parseLFSPointer(b)
+	if !ok {
+		return b, nil
+	}
+	if !opts.LFS {
+		return nil, fmt.Errorf("%s is a Git LFS pointer (oid %s), enable lfs to download it", manifest, pointer.Oid)
+	}
+
+	klog.Infof("Downloading %s (LFS object %s) of %s", manifest, pointer.Oid, repository)
+	return fetchLFSObject(repository, a, pointer)
+}
+
+// lfsAction is an LFS server href with the headers to send to it
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// fetchLFSObject downloads an object with the Git LFS batch API. For SSH
+// repositories the LFS server and its credentials are given by
+// git-lfs-authenticate, for HTTPS repositories the same credentials are used.
+func fetchLFSObject(repository string, a Auth, pointer *lfsPointer) ([]byte, error) {
+
+	ep, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var server lfsAction
+	switch ep.Protocol {
+	case "ssh":
+		server, err = lfsAuthenticate(repository, ep, a)
+		if err != nil {
+			return nil, fmt.Errorf("git-lfs-authenticate: %s", err)
+		}
+	case "http", "https":
+		ep.User, ep.Password = "", ""
+		server.Href = strings.TrimSuffix(ep.String(), "/")
+		if !strings.HasSuffix(server.Href, ".git") {
+			server.Href += ".git"
+		}
+		server.Href += "/info/lfs"
+	default:
+		return nil, fmt.Errorf("Git LFS isn't supported for %s repositories", ep.Protocol)
+	}
+
+	batch, err := json.Marshal(map[string]interface{}{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   []*lfsPointer{pointer},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Objects []struct {
+			Actions struct {
+				Download *lfsAction `json:"download"`
+			} `json:"actions"`
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	body, err := lfsRequest("POST", strings.TrimSuffix(server.Href, "/")+"/objects/batch", server.Header, a, batch, -1)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Objects) != 1 {
+		return nil, fmt.Errorf("LFS batch API returned %d objects", len(resp.Objects))
+	}
+	object := resp.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("LFS object %s: %d %s", pointer.Oid, object.Error.Code, object.Error.Message)
+	}
+	if object.Actions.Download == nil {
+		return nil, fmt.Errorf("LFS batch API returned no download action for %s", pointer.Oid)
+	}
+
+	download := object.Actions.Download
+	b, err := lfsRequest("GET", download.Href, download.Header, Auth{}, nil, pointer.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != pointer.Oid {
+		return nil, fmt.Errorf("LFS object %s has a different checksum", pointer.Oid)
+	}
+	return b, nil
+}
+
+// lfsRequest sends a request to the LFS server. Basic auth is used only if
+// headers don't already authorize the request. If size isn't negative, the
+// response must have this size.
+func lfsRequest(method string, url string, header map[string]string, a Auth, body []byte, size int64) ([]byte, error) {
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Accept", lfsMediaType)
+		req.Header.Set("Content-Type", lfsMediaType)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Authorization") == "" && (len(a.Username) != 0 || len(a.Password) != 0) {
+		req.SetBasicAuth(string(a.Username), string(a.Password))
+	}
+
+	resp, err := lfsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if size >= 0 {
+		reader = io.LimitReader(resp.Body, size+1)
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LFS server returned %d: %s", resp.StatusCode, string(b))
+	}
+	if size >= 0 && int64(len(b)) != size {
+		return nil, fmt.Errorf("LFS object has size %d instead of %d", len(b), size)
+	}
+	return b, nil
+}
+
+// lfsAuthenticate runs git-lfs-authenticate on the SSH server of the
+// repository with the same key and host key verification as git.
+func lfsAuthenticate(repository string, ep *transport.Endpoint, a Auth) (lfsAction, error) {
+
+	var server lfsAction
+
+	auth, verifier, err := newAuth(repository, a)
+	if err != nil {
+		return server, err
+	}
+	publicKeys, ok := auth.(*gitssh.PublicKeys)
+	if !ok {
+		return server, fmt.Errorf("an SSH private key is required")
+	}
+	config, err := publicKeys.ClientConfig()
+	if err != nil {
+		return server, err
+	}
+
+	port := ep.Port
+	if port == 0 {
+		port = gitssh.DefaultPort
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(ep.Host, strconv.Itoa(port)), config)
+	if err != nil {
+		return server, verifier.wrap(err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return server, err
+	}
+	defer session.Close()
+
+	out, err := session.Output(fmt.Sprintf("git-lfs-authenticate '%s' download", strings.TrimPrefix(ep.Path, "/")))
+	if err != nil {
+		return server, err
+	}
+	err = json.Unmarshal(out, &server)
+	return server, err
+}
@@ -0,0 +1,35 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLFSPointer(t *testing.T) {
+
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n"
+
+	p, ok := parseLFSPointer([]byte(pointer))
+	if !ok {
+		t.Fatal("pointer not detected")
+	}
+	if p.Oid != oid || p.Size != 12345 {
+		t.Errorf("got %+v", p)
+	}
+
+	for _, b := range []string{
+		"kind: Job\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:1234\nsize 1\n",
+		pointer + strings.Repeat("#", lfsPointerMaxSize),
+	} {
+		if _, ok := parseLFSPointer([]byte(b)); ok {
+			t.Errorf("%q detected as a pointer", b)
+		}
+	}
+
+	_, err := readLFS([]byte(pointer), "https://github.com/appspero/kube-git.git", Auth{}, "job.yaml", FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "enable lfs") {
+		t.Errorf("got error %v, want an error asking to enable lfs", err)
+	}
+}
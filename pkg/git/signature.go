@@ -0,0 +1,63 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"k8s.io/klog"
+)
+
+const (
+	pgpPublicKeyBlockBegin = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	sshSignatureBegin      = "-----BEGIN SSH SIGNATURE-----"
+)
+
+// SignatureError is returned when the commit isn't signed or its signature
+// isn't made by one of the trusted keys
+type SignatureError struct {
+	Commit string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("signature verification of commit %s failed: %s", e.Commit, e.Err)
+}
+
+// verifyCommit verifies the OpenPGP signature of the commit with each of the
+// armored public keys until one of them verifies it
+func verifyCommit(commit *object.Commit, keys []string) error {
+
+	hash := commit.Hash.String()
+
+	if commit.PGPSignature == "" {
+		return &SignatureError{Commit: hash, Err: fmt.Errorf("the commit isn't signed")}
+	}
+	if strings.HasPrefix(strings.TrimSpace(commit.PGPSignature), sshSignatureBegin) {
+		return &SignatureError{Commit: hash, Err: fmt.Errorf("SSH signatures aren't supported, only OpenPGP signatures are")}
+	}
+
+	var errs []string
+	for _, key := range keys {
+		entity, err := commit.Verify(key)
+		if err == nil {
+			klog.Infof("Commit %s is signed by key %X", hash, entity.PrimaryKey.Fingerprint)
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return &SignatureError{Commit: hash, Err: fmt.Errorf("no trusted key verified the signature: %s", strings.Join(errs, ", "))}
+}
+
+// SplitArmoredKeys splits the armored OpenPGP public key blocks of data, as
+// Commit.Verify only reads the first block of a key ring
+func SplitArmoredKeys(data string) []string {
+
+	var keys []string
+	blocks := strings.Split(data, pgpPublicKeyBlockBegin)
+	for _, block := range blocks[1:] {
+		keys = append(keys, pgpPublicKeyBlockBegin+block)
+	}
+	return keys
+}
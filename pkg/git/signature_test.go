@@ -0,0 +1,99 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) string {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func TestVerifyCommit(t *testing.T) {
+
+	trusted, err := openpgp.NewEntity("trusted", "", "trusted@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "kube-git-signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "job.yaml"), []byte(testContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("job.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	author := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	signed, err := w.Commit("signed", &git.CommitOptions{Author: author, SignKey: trusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedByOther, err := w.Commit("signed by other", &git.CommitOptions{Author: author, SignKey: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := w.Commit("unsigned", &git.CommitOptions{Author: author})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key ring with several armored blocks
+	keys := SplitArmoredKeys(armoredPublicKey(t, other) + "\n" + armoredPublicKey(t, trusted))
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+
+	b, err := readFile(repo.Storer, signed, "job.yaml", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testContent {
+		t.Errorf("got %q, want %q", b, testContent)
+	}
+
+	// only the key of trusted
+	trustedKeys := keys[1:]
+	for _, hash := range []plumbing.Hash{signedByOther, unsigned} {
+		_, err := readFile(repo.Storer, hash, "job.yaml", trustedKeys)
+		if _, ok := err.(*SignatureError); !ok {
+			t.Errorf("commit %s: got error %v, want a SignatureError", hash, err)
+		}
+	}
+}
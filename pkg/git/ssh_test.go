@@ -0,0 +1,441 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+const (
+	testManifest   = "deploy/job.yaml"
+	testContent    = "kind: Job\n"
+	testPassphrase = "passphrase"
+)
+
+func TestMain(m *testing.M) {
+	// don't let the ssh_config of the user running the tests change the host or port
+	gitssh.DefaultSSHConfig = nil
+	os.Exit(m.Run())
+}
+
+// testServer is an SSH git server serving upload-pack for a single repository,
+// it accepts the public keys of testdata and records the user of the last
+// connection.
+type testServer struct {
+	t        *testing.T
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.Signer
+	git      transport.Transport
+	hash     string
+
+	mu   sync.Mutex
+	user string
+}
+
+func newTestServer(t *testing.T) *testServer {
+
+	dir, err := ioutil.TempDir("", "kube-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(testManifest)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, testManifest), []byte(testContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(testManifest); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("add job", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{
+		t:    t,
+		hash: hash.String(),
+		git:  server.NewServer(server.MapLoader{"file:///kube-git.git": repo.Storer}),
+	}
+
+	s.hostKey = readSigner(t, "host_ed25519")
+	authorized := map[string]bool{}
+	for _, name := range []string{"id_rsa_pem", "id_rsa", "id_ed25519", "id_ecdsa", "id_ed25519_encrypted", "id_rsa_pem_encrypted"} {
+		authorized[string(readPublicKey(t, name+".pub").Marshal())] = true
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !authorized[string(key.Marshal())] {
+				return nil, fmt.Errorf("unknown public key for %s", conn.User())
+			}
+			s.mu.Lock()
+			s.user = conn.User()
+			s.mu.Unlock()
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(s.hostKey)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.listener.Close() })
+	go s.serve()
+
+	return s
+}
+
+func (s *testServer) url(user string) string {
+	if user != "" {
+		user += "@"
+	}
+	return fmt.Sprintf("ssh://%s%s/kube-git.git", user, s.listener.Addr())
+}
+
+func (s *testServer) lastUser() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+func (s *testServer) knownHosts(key ssh.PublicKey) []byte {
+	return []byte(knownhosts.Line([]string{knownhosts.Normalize(s.listener.Addr().String())}, key) + "\n")
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				status := uint32(0)
+				if err := s.uploadPack(exec.Command, ch); err != nil {
+					fmt.Fprintln(ch.Stderr(), err)
+					status = 128
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				ch.Close()
+			}
+		}()
+	}
+}
+
+// uploadPack serves a git-upload-pack command like git-upload-pack would
+func (s *testServer) uploadPack(command string, rw io.ReadWriter) error {
+
+	if !strings.HasPrefix(command, "git-upload-pack ") {
+		return fmt.Errorf("unsupported command: %s", command)
+	}
+	ep, err := transport.NewEndpoint(strings.Trim(strings.TrimPrefix(command, "git-upload-pack "), "'"))
+	if err != nil {
+		return err
+	}
+
+	session, err := s.git.NewUploadPackSession(ep, nil)
+	if err != nil {
+		return err
+	}
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+	if err := ar.Encode(rw); err != nil {
+		return err
+	}
+
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(rw); err != nil {
+		return err
+	}
+	resp, err := session.UploadPack(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	return resp.Encode(rw)
+}
+
+func readKey(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func readSigner(t *testing.T, name string) ssh.Signer {
+	signer, err := ssh.ParsePrivateKey(readKey(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func readPublicKey(t *testing.T, name string) ssh.PublicKey {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(readKey(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFetchGitFileSSHKeyTypes(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		key        string
+		passphrase string
+	}{
+		{key: "id_rsa_pem"},
+		{key: "id_rsa"},
+		{key: "id_ed25519"},
+		{key: "id_ecdsa"},
+		{key: "id_ed25519_encrypted", passphrase: testPassphrase},
+		{key: "id_rsa_pem_encrypted", passphrase: testPassphrase},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			a := Auth{
+				SshPrivateKey: readKey(t, test.key),
+				SshPassphrase: []byte(test.passphrase),
+				KnownHosts:    s.knownHosts(s.hostKey.PublicKey()),
+			}
+			b, err := FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != testContent {
+				t.Errorf("got %q, want %q", b, testContent)
+			}
+		})
+	}
+}
+
+func TestFetchGitFileSSHPassphrase(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		key        string
+		passphrase string
+		err        string
+	}{
+		{key: "id_ed25519_encrypted", err: "no passphrase is configured"},
+		{key: "id_rsa_pem_encrypted", err: "no passphrase is configured"},
+		{key: "id_ed25519_encrypted", passphrase: "wrong", err: "passphrase of the SSH private key is incorrect"},
+		{key: "id_rsa_pem_encrypted", passphrase: "wrong", err: "passphrase of the SSH private key is incorrect"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key+"/"+test.passphrase, func(t *testing.T) {
+			a := Auth{
+				SshPrivateKey: readKey(t, test.key),
+				SshPassphrase: []byte(test.passphrase),
+			}
+			_, err := FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFetchGitFileSSHUser(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		urlUser string
+		sshUser string
+		want    string
+	}{
+		{name: "default", want: "git"},
+		{name: "url", urlUser: "deploy", want: "deploy"},
+		{name: "sshUser", urlUser: "deploy", sshUser: "ci", want: "ci"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := Auth{
+				SshPrivateKey: readKey(t, "id_ed25519"),
+				SshUser:       test.sshUser,
+				KnownHosts:    s.knownHosts(s.hostKey.PublicKey()),
+			}
+			if _, err := FetchGitFile(s.url(test.urlUser), "refs/heads/master", a, s.hash, testManifest, FetchOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if user := s.lastUser(); user != test.want {
+				t.Errorf("got user %q, want %q", user, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchGitFileSSHKnownHosts(t *testing.T) {
+	s := newTestServer(t)
+
+	a := Auth{
+		SshPrivateKey: readKey(t, "id_ed25519"),
+		KnownHosts:    s.knownHosts(readPublicKey(t, "id_ecdsa.pub")),
+	}
+	_, err := FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{})
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("got error %v, want a HostKeyError", err)
+	}
+}
+
+func TestFetchGitFileSSHNoKnownHosts(t *testing.T) {
+	s := newTestServer(t)
+
+	a := Auth{SshPrivateKey: readKey(t, "id_ed25519")}
+	_, err := FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no known hosts") {
+		t.Fatalf("got error %v, want no known hosts error", err)
+	}
+
+	a.InsecureIgnoreHostKey = true
+	if _, err := FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepositoryCacheSSH(t *testing.T) {
+	s := newTestServer(t)
+
+	dir, err := ioutil.TempDir("", "kube-git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewRepositoryCache(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auth{
+		SshPrivateKey: readKey(t, "id_ecdsa"),
+		KnownHosts:    s.knownHosts(s.hostKey.PublicKey()),
+	}
+	for i := 0; i < 2; i++ {
+		b, err := c.FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, []byte(testContent)) {
+			t.Errorf("got %q, want %q", b, testContent)
+		}
+	}
+}
+
+func TestRepositoryCacheCredentials(t *testing.T) {
+	s := newTestServer(t)
+
+	dir, err := ioutil.TempDir("", "kube-git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewRepositoryCache(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auth{
+		SshPrivateKey: readKey(t, "id_ecdsa"),
+		KnownHosts:    s.knownHosts(s.hostKey.PublicKey()),
+	}
+	if _, err := c.FetchGitFile(s.url("git"), "refs/heads/master", a, s.hash, testManifest, FetchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a key the server doesn't authorize must not be served the cached commit
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := Auth{
+		SshPrivateKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+		KnownHosts:    a.KnownHosts,
+	}
+	if _, err := c.FetchGitFile(s.url("git"), "refs/heads/master", other, s.hash, testManifest, FetchOptions{}); err == nil {
+		t.Fatal("got no error fetching with an unauthorized key from the cache")
+	}
+}
@@ -0,0 +1,182 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+
+	"k8s.io/klog"
+)
+
+// nested submodules are followed up to this depth
+const maxSubmoduleDepth = 5
+
+// FetchOptions are the optional features used to read the manifest
+type FetchOptions struct {
+	// Submodules reads the manifest from a submodule if its path is in one
+	Submodules bool
+	// LFS downloads the manifest from the Git LFS server if it's an LFS pointer
+	LFS bool
+	// SignatureKeys are armored OpenPGP public keys, if set the commit must be
+	// signed by one of them. Submodule commits aren't verified.
+	SignatureKeys []string
+}
+
+// submoduleError is returned by readFile when the manifest is in a submodule
+type submoduleError struct {
+	// Path of the submodule in the repository
+	Path string
+	// URL and Branch of the submodule from .gitmodules
+	URL    string
+	Branch string
+	// Hash is the commit of the submodule
+	Hash plumbing.Hash
+	// Manifest is the path of the manifest in the submodule
+	Manifest string
+}
+
+func (e *submoduleError) Error() string {
+	return fmt.Sprintf("the manifest is in the submodule %s (%s)", e.Path, e.URL)
+}
+
+type fetchFunc func(repository string, branch string, a Auth, hash string, manifest string, keys []string) ([]byte, error)
+
+// fetchManifest reads the manifest with fetch, following it into submodules
+// and downloading it from Git LFS if opts allow it. The credentials of a are
+// only sent to the submodules on the host of the repository, the others are
+// fetched anonymously.
+func fetchManifest(fetch fetchFunc, repository string, branch string, a Auth, hash string, manifest string, opts FetchOptions) ([]byte, error) {
+
+	origin, auth := repository, a
+	keys := opts.SignatureKeys
+	for depth := 0; ; depth++ {
+		b, err := fetch(repository, branch, a, hash, manifest, keys)
+		sub, ok := err.(*submoduleError)
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+			return readLFS(b, repository, a, manifest, opts)
+		}
+
+		if !opts.Submodules {
+			return nil, fmt.Errorf("%s is in the submodule %s of %s, enable submodules to fetch it", manifest, sub.Path, repository)
+		}
+		if depth >= maxSubmoduleDepth {
+			return nil, fmt.Errorf("%s is nested in more than %d submodules", manifest, maxSubmoduleDepth)
+		}
+
+		subRepository, err := submoduleURL(repository, sub.URL)
+		if err != nil {
+			return nil, err
+		}
+		switch sub.Branch {
+		case "":
+			branch = ""
+		case ".":
+			// same branch as the superproject
+		default:
+			branch = plumbing.NewBranchReferenceName(sub.Branch).String()
+		}
+
+		a = auth
+		if !sameHost(origin, subRepository) {
+			a = Auth{KnownHosts: auth.KnownHosts, InsecureIgnoreHostKey: auth.InsecureIgnoreHostKey}
+		}
+
+		klog.Infof("Fetching %s of submodule %s of %s from %s at revision %s", sub.Manifest, sub.Path, repository, subRepository, sub.Hash)
+		// the submodule commit is pinned by the verified commit
+		repository, hash, manifest, keys = subRepository, sub.Hash.String(), sub.Manifest, nil
+	}
+}
+
+// findSubmodule returns a submoduleError if a parent directory of the manifest
+// is a submodule in the tree of commit.
+func findSubmodule(commit *object.Commit, manifest string) error {
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(manifest, "/")
+	for i := 1; i < len(parts); i++ {
+		subPath := strings.Join(parts[:i], "/")
+		entry, err := tree.FindEntry(subPath)
+		if err != nil {
+			return nil
+		}
+		if entry.Mode != filemode.Submodule {
+			continue
+		}
+
+		file, err := tree.File(".gitmodules")
+		if err != nil {
+			return fmt.Errorf("%s is a submodule but .gitmodules can't be read: %s", subPath, err)
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return err
+		}
+		modules := config.NewModules()
+		if err := modules.Unmarshal([]byte(content)); err != nil {
+			return err
+		}
+		for _, m := range modules.Submodules {
+			if path.Clean(m.Path) == subPath {
+				return &submoduleError{
+					Path:     subPath,
+					URL:      m.URL,
+					Branch:   m.Branch,
+					Hash:     entry.Hash,
+					Manifest: strings.Join(parts[i:], "/"),
+				}
+			}
+		}
+		return fmt.Errorf("submodule %s not found in .gitmodules", subPath)
+	}
+	return nil
+}
+
+// submoduleURL resolves the URL of a submodule, relative URLs (./ or ../) are
+// relative to the repository like git does.
+func submoduleURL(repository string, url string) (string, error) {
+
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url, nil
+	}
+
+	ep, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return "", err
+	}
+	ep.Path = path.Join(ep.Path, url)
+	return ep.String(), nil
+}
+
+// sameHost returns whether two repository URLs have the same protocol, host and
+// port, so the credentials of one can be sent to the other
+func sameHost(repository string, url string) bool {
+
+	a, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return false
+	}
+	b, err := transport.NewEndpoint(url)
+	if err != nil {
+		return false
+	}
+	port := func(ep *transport.Endpoint) int {
+		if ep.Port == 0 {
+			return defaultPorts[ep.Protocol]
+		}
+		return ep.Port
+	}
+	return a.Protocol == b.Protocol && strings.EqualFold(a.Host, b.Host) && port(a) == port(b)
+}
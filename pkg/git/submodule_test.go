@@ -0,0 +1,72 @@
+package git
+
+import "testing"
+
+func TestSubmoduleURL(t *testing.T) {
+
+	tests := []struct {
+		repository string
+		url        string
+		want       string
+	}{
+		{"git@github.com:appspero/kube-git.git", "git@github.com:appspero/ci.git", "git@github.com:appspero/ci.git"},
+		{"git@github.com:appspero/kube-git.git", "../ci.git", "ssh://git@github.com/appspero/ci.git"},
+		{"https://github.com/appspero/kube-git.git", "../../shared/ci.git", "https://github.com/shared/ci.git"},
+		{"https://github.com/appspero/kube-git", "./ci", "https://github.com/appspero/kube-git/ci"},
+	}
+
+	for _, test := range tests {
+		got, err := submoduleURL(test.repository, test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("submoduleURL(%q, %q) = %q, want %q", test.repository, test.url, got, test.want)
+		}
+	}
+}
+
+func TestFetchManifestSubmoduleAuth(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		submodule string
+		auth      bool
+	}{
+		{name: "relative URL", submodule: "../ci.git", auth: true},
+		{name: "same host", submodule: "https://github.com/shared/ci.git", auth: true},
+		{name: "other host", submodule: "https://attacker.example/shared/ci.git"},
+		{name: "other protocol", submodule: "http://github.com/shared/ci.git"},
+		{name: "other port", submodule: "https://github.com:8443/shared/ci.git"},
+		{name: "SSH URL", submodule: "git@github.com:shared/ci.git"},
+	}
+
+	a := Auth{Username: []byte("user"), Password: []byte("token"), KnownHosts: []byte("known_hosts")}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auths := make(map[string]Auth)
+			fetch := func(repository string, branch string, a Auth, hash string, manifest string, keys []string) ([]byte, error) {
+				auths[repository] = a
+				if manifest == "ci/manifest.yaml" {
+					return nil, &submoduleError{Path: "ci", URL: test.submodule, Manifest: "manifest.yaml"}
+				}
+				return []byte("manifest"), nil
+			}
+			if _, err := fetchManifest(fetch, "https://github.com/appspero/kube-git.git", "refs/heads/main", a, "", "ci/manifest.yaml", FetchOptions{Submodules: true}); err != nil {
+				t.Fatal(err)
+			}
+
+			subRepository, _ := submoduleURL("https://github.com/appspero/kube-git.git", test.submodule)
+			got, ok := auths[subRepository]
+			if !ok {
+				t.Fatalf("submodule %s not fetched", subRepository)
+			}
+			if sent := got.Password != nil; sent != test.auth {
+				t.Errorf("got credentials sent %v, want %v", sent, test.auth)
+			}
+			if string(got.KnownHosts) != "known_hosts" {
+				t.Errorf("got known hosts %q, want the known hosts of the repository", got.KnownHosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// defaultPorts are the ports left out of a normalized URL
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"git":   9418,
+	"ssh":   22,
+}
+
+// NormalizeURL returns the host and path of a repository URL without the
+// protocol, user, default port and .git suffix, so the SSH and HTTPS URLs of a
+// repository are the same, eg. github.com/appspero/kube-git for both
+// git@github.com:appspero/kube-git.git and https://github.com/appspero/kube-git.
+// A URL that can't be parsed is returned as is.
+func NormalizeURL(repository string) string {
+
+	ep, err := transport.NewEndpoint(repository)
+	if err != nil || ep.Protocol == "file" {
+		return repository
+	}
+
+	host := strings.ToLower(ep.Host)
+	if ep.Port != 0 && ep.Port != defaultPorts[ep.Protocol] {
+		host = fmt.Sprintf("%s:%d", host, ep.Port)
+	}
+	path := strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git")
+	return host + "/" + strings.TrimSuffix(path, "/")
+}
@@ -0,0 +1,26 @@
+package git
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+
+	tests := []struct {
+		repository string
+		want       string
+	}{
+		{"git@github.com:appspero/kube-git.git", "github.com/appspero/kube-git"},
+		{"ssh://git@github.com/appspero/kube-git.git", "github.com/appspero/kube-git"},
+		{"ssh://git@github.com:22/appspero/kube-git", "github.com/appspero/kube-git"},
+		{"https://github.com/appspero/kube-git.git", "github.com/appspero/kube-git"},
+		{"https://GitHub.com/appspero/kube-git/", "github.com/appspero/kube-git"},
+		{"http://git.example.com:8080/ci.git", "git.example.com:8080/ci"},
+		{"ssh://git@git.example.com:2222/ci.git", "git.example.com:2222/ci"},
+		{"/srv/git/ci.git", "/srv/git/ci.git"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeURL(test.repository); got != test.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", test.repository, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package githubapp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/appspero/kube-git/pkg/tools"
+)
+
+// DefaultAPI is the API of github.com, GitHub Enterprise uses https://<host>/api/v3
+const DefaultAPI = "https://api.github.com"
+
+// tokens are renewed this long before they expire
+const expiryMargin = 5 * time.Minute
+
+// App authenticates as a GitHub App and mints installation tokens for the
+// repositories the App is installed on. The tokens are cached per repository
+// until they expire.
+type App struct {
+	id  int64
+	key *rsa.PrivateKey
+	api string
+
+	client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]*installationToken
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewApp creates an App from its ID and its PEM encoded private key. If api is
+// empty, DefaultAPI is used.
+func NewApp(id int64, privateKey []byte, api string) (*App, error) {
+
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key of GitHub App %d: %s", id, err)
+	}
+
+	if api == "" {
+		api = DefaultAPI
+	}
+
+	return &App{
+		id:     id,
+		key:    key,
+		api:    strings.TrimSuffix(api, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+		tokens: make(map[string]*installationToken),
+	}, nil
+}
+
+// LoadApp creates an App reading the private key from privateKeyFile
+func LoadApp(id int64, privateKeyFile string, api string) (*App, error) {
+
+	privateKey, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewApp(id, privateKey, api)
+}
+
+// Host returns the host of the repositories of the App, github.com for
+// DefaultAPI and the host of the API for GitHub Enterprise
+func (a *App) Host() string {
+	u, err := url.Parse(a.api)
+	if err != nil {
+		return ""
+	}
+	if strings.EqualFold(u.Host, "api.github.com") {
+		return "github.com"
+	}
+	return u.Host
+}
+
+// Token returns an installation token limited to the repository, which can be
+// its SSH or HTTPS URL.
+func (a *App) Token(repository string) (string, error) {
+
+	owner, repo := tools.ParseGithubRepository(repository)
+	if owner == "" || repo == "" {
+		return "", fmt.Errorf("Could't parse GitHub repository or owner: %s", repository)
+	}
+	fullName := owner + "/" + repo
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t, ok := a.tokens[fullName]; ok && time.Now().Add(expiryMargin).Before(t.ExpiresAt) {
+		return t.Token, nil
+	}
+
+	t, err := a.newInstallationToken(owner, repo)
+	if err != nil {
+		return "", err
+	}
+	a.tokens[fullName] = t
+	return t.Token, nil
+}
+
+func (a *App) newInstallationToken(owner string, repo string) (*installationToken, error) {
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	err := a.do("GET", fmt.Sprintf("%s/repos/%s/%s/installation", a.api, owner, repo), nil, http.StatusOK, &installation)
+	if err != nil {
+		return nil, fmt.Errorf("getting installation of GitHub App %d for %s/%s: %s", a.id, owner, repo, err)
+	}
+
+	klog.Infof("Creating token of GitHub App %d installation %d for %s/%s", a.id, installation.ID, owner, repo)
+
+	body, err := json.Marshal(map[string][]string{"repositories": {repo}})
+	if err != nil {
+		return nil, err
+	}
+	var t installationToken
+	err = a.do("POST", fmt.Sprintf("%s/app/installations/%d/access_tokens", a.api, installation.ID), body, http.StatusCreated, &t)
+	if err != nil {
+		return nil, fmt.Errorf("creating token of GitHub App %d installation %d: %s", a.id, installation.ID, err)
+	}
+	return &t, nil
+}
+
+// do sends a request authenticated as the App and decodes the response in v
+func (a *App) do(method string, url string, body []byte, status int, v interface{}) error {
+
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != status {
+		return fmt.Errorf("GitHub API returned %d: %s", resp.StatusCode, string(data))
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwt returns the RS256 JSON Web Token authenticating the App, valid for 10
+// minutes (the maximum allowed by GitHub) with a minute of clock drift.
+func (a *App) jwt(now time.Time) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.id,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kubegit"
+
+var (
+	RepositoryCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "repository_cache",
+		Name:      "hits_total",
+		Help:      "Number of fetches that found the repository mirror in the cache.",
+	})
+	RepositoryCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "repository_cache",
+		Name:      "misses_total",
+		Help:      "Number of fetches that had to create the repository mirror.",
+	})
+	RepositoryCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "repository_cache",
+		Name:      "evictions_total",
+		Help:      "Number of repository mirrors evicted from the cache.",
+	})
+	RepositoryCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "repository_cache",
+		Name:      "size_bytes",
+		Help:      "Size of the repository mirrors in the cache.",
+	})
+	RepositoryCacheRepositories = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "repository_cache",
+		Name:      "repositories",
+		Help:      "Number of repository mirrors in the cache.",
+	})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "Number of webhook deliveries by provider, event and result.",
+	}, []string{"provider", "event", "result"})
+	GitHookMatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "githook_matches_total",
+		Help:      "Number of pushes matching the repository and branches of a GitHook.",
+	}, []string{"namespace", "githook"})
+
+	FetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "git",
+		Name:      "fetch_duration_seconds",
+		Help:      "Time to fetch a commit by method (fetch of the commit, clone of the branch or fetch into the repository cache) and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"method", "result"})
+	FetchBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "git",
+		Name:      "fetched_bytes_total",
+		Help:      "Bytes of git objects fetched by method.",
+	}, []string{"method"})
+
+	Applies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "apply",
+		Name:      "total",
+		Help:      "Number of manifests applied by kind and result.",
+	}, []string{"kind", "result"})
+
+	NotificationSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notification",
+		Name:      "sends_total",
+		Help:      "Number of notifications sent by provider and result.",
+	}, []string{"provider", "result"})
+	NotificationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "notification",
+		Name:      "send_duration_seconds",
+		Help:      "Time to send a notification by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	Runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "runs",
+		Name:      "finished_total",
+		Help:      "Number of resources created by a GitHook that finished, by kind and outcome.",
+	}, []string{"namespace", "githook", "kind", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		RepositoryCacheHits,
+		RepositoryCacheMisses,
+		RepositoryCacheEvictions,
+		RepositoryCacheSize,
+		RepositoryCacheRepositories,
+		WebhookDeliveries,
+		GitHookMatches,
+		FetchDuration,
+		FetchBytes,
+		Applies,
+		NotificationSends,
+		NotificationDuration,
+		Runs,
+	)
+}
+
+// Result is the result label of err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
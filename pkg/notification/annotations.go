@@ -1,17 +1,20 @@
 package notification
 
 import (
-	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1alpha1"
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
 )
 
 func GetNotificationAnnotations(gh *ghapi.GitHook) map[string]string {
 	annotations := make(map[string]string)
 
-	if gh.Spec.Notification.Slack != "" {
-		annotations["kubegit.appspero.com/slack"] = gh.Spec.Notification.Slack
-	}
-	if gh.Spec.Notification.Github != "" {
-		annotations["kubegit.appspero.com/github"] = gh.Spec.Notification.Github
+	// comma separated names of the notification configs of each provider
+	for _, n := range gh.Spec.Notifications {
+		key := "kubegit.appspero.com/" + n.Provider
+		if names, ok := annotations[key]; ok {
+			annotations[key] = names + "," + n.Name
+		} else {
+			annotations[key] = n.Name
+		}
 	}
 
 	if len(annotations) > 0 {
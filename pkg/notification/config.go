@@ -5,7 +5,11 @@ import(
   "github.com/ghodss/yaml"
 	"io/ioutil"
   "strings"
+  "time"
   "k8s.io/klog"
+
+  "github.com/appspero/kube-git/pkg/githubapp"
+  "github.com/appspero/kube-git/pkg/metrics"
 )
 
 type Config struct {
@@ -16,7 +20,27 @@ type Config struct {
 type GithubConfig struct {
   URL   string `json:"url"`
   Token string `json:"token"`
+  // API is the GitHub API base URL, https://<host>/api/v3 for GitHub Enterprise
   API   string `json:"api"`
+
+  // GitHub App used instead of Token, its private key is read from PrivateKeyFile
+  AppID          int64  `json:"appID"`
+  PrivateKeyFile string `json:"privateKeyFile"`
+  App            *githubapp.App `json:"-"`
+  // AllowedNamespaces are the namespaces of the GitHooks that may fetch their
+  // repository with the installation token of the GitHub App, none if empty
+  AllowedNamespaces []string `json:"allowedNamespaces"`
+}
+
+// AppAllowed returns whether the GitHooks of namespace may fetch with the
+// installation token of the GitHub App
+func (g GithubConfig) AppAllowed(namespace string) bool {
+  for _, n := range g.AllowedNamespaces {
+    if n == namespace {
+      return true
+    }
+  }
+  return false
 }
 
 type SlackConfig struct {
@@ -41,8 +65,18 @@ func LoadConfig(configFile string) (*Config, error) {
     if v.URL == "" {
       return nil, fmt.Errorf("Missing notification URL for GitHub notification config %s", k)
     }
-    if v.Token == "" {
-      return nil, fmt.Errorf("Missing token for GitHub notification config %s", k)
+    if v.AppID != 0 {
+      if v.PrivateKeyFile == "" {
+        return nil, fmt.Errorf("Missing private key file for GitHub App of GitHub notification config %s", k)
+      }
+      app, err := githubapp.LoadApp(v.AppID, v.PrivateKeyFile, v.API)
+      if err != nil {
+        return nil, err
+      }
+      v.App = app
+      cfg.Github[k] = v
+    } else if v.Token == "" {
+      return nil, fmt.Errorf("Missing token or GitHub App for GitHub notification config %s", k)
     }
   }
 
@@ -62,25 +96,39 @@ func LoadConfig(configFile string) (*Config, error) {
 func (c Config) Notify(status string, kind string, namespace string, name string, annotations map[string]string) {
 
   if slackValue, slack := annotations["kubegit.appspero.com/slack"]; slack {
-    if s, ok := c.Slack[slackValue]; ok {
-      err := s.Notify(status, kind, namespace, name, annotations)
-      if err != nil {
-        klog.Errorf("Error sending slack notification '%s': %s", slackValue, err)
+    for _, config := range strings.Split(slackValue, ",") {
+      if s, ok := c.Slack[config]; ok {
+        start := time.Now()
+        err := s.Notify(status, kind, namespace, name, annotations)
+        observeSend("slack", start, err)
+        if err != nil {
+          klog.Errorf("Error sending slack notification '%s': %s", config, err)
+        }
       }
     }
   }
 
   if githubValue, github := annotations["kubegit.appspero.com/github"]; github {
-    if g, ok := c.Github[githubValue]; ok {
-      err := g.Notify(status, kind, namespace, name, annotations)
-      if err != nil {
-        klog.Errorf("Error sending slack notification '%s': %s", githubValue, err)
+    for _, config := range strings.Split(githubValue, ",") {
+      if g, ok := c.Github[config]; ok {
+        start := time.Now()
+        err := g.Notify(status, kind, namespace, name, annotations)
+        observeSend("github", start, err)
+        if err != nil {
+          klog.Errorf("Error sending github notification '%s': %s", config, err)
+        }
       }
     }
   }
 
 }
 
+// observeSend records a notification sent by provider in the metrics
+func observeSend(provider string, start time.Time, err error) {
+  metrics.NotificationDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+  metrics.NotificationSends.WithLabelValues(provider, metrics.Result(err)).Inc()
+}
+
 func renderURL(url string, resourceNamespace string, resourceName string) string {
   url = strings.Replace(url, "${NAMESPACE}", resourceNamespace, -1)
   url = strings.Replace(url, "${NAME}", resourceName, -1)
@@ -8,6 +8,9 @@ import(
   "fmt"
   "strings"
   "k8s.io/klog"
+
+  "github.com/appspero/kube-git/pkg/githubapp"
+  "github.com/appspero/kube-git/pkg/tools"
 )
 
 type GithubStatus struct {
@@ -41,16 +44,30 @@ func (g GithubConfig) Notify(status string, kind string, namespace string, name
     }
 
   repository := annotations["kubegit.appspero.com/repository"]
-  owner, repo := parseGithubRepository(repository)
+  owner, repo := tools.ParseGithubRepository(repository)
   if owner == "" || repo == "" {
     return fmt.Errorf("Could't parse GitHub repository or owner: %s", repository)
   }
 
+  token, err := g.GetToken(repository)
+  if err != nil {
+    return err
+  }
+
   if g.API == "" {
-    g.API = "https://api.github.com"
+    g.API = githubapp.DefaultAPI
+  }
+  apiURL := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", strings.TrimSuffix(g.API, "/"), owner, repo, annotations["kubegit.appspero.com/commit"])
+  return githubStatus.SendGithubStatus(token, apiURL)
+}
+
+// GetToken returns the token of the config, or an installation token of its
+// GitHub App for the repository
+func (g GithubConfig) GetToken(repository string) (string, error) {
+  if g.App != nil {
+    return g.App.Token(repository)
   }
-  apiURL := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", g.API, owner, repo, annotations["kubegit.appspero.com/commit"])
-  return githubStatus.SendGithubStatus(g.Token, apiURL)
+  return g.Token, nil
 }
 
 func (s GithubStatus) SendGithubStatus(token string, apiURL string) error {
@@ -67,7 +84,7 @@ func (s GithubStatus) SendGithubStatus(token string, apiURL string) error {
     return err
   }
   req.Header.Set("Content-Type", "application/json")
-  req.SetBasicAuth(token, "x-oauth-basic")
+  req.Header.Set("Authorization", "token "+token)
 
   client := &http.Client{}
   resp, err := client.Do(req)
@@ -84,18 +101,3 @@ func (s GithubStatus) SendGithubStatus(token string, apiURL string) error {
   return nil
 
 }
-
-func parseGithubRepository(repository string) (string, string) {
-  // https://github.com/appspero/kube-git.git
-  // git@github.com:appspero/kube-git.git
-  repoTokenize := strings.Split(repository, "/")
-  if len(repoTokenize) >= 2 {
-    owner := repoTokenize[len(repoTokenize)-2]
-    if len(strings.Split(owner, ":")) == 2 {
-      owner = strings.Split(owner, ":")[1]
-    }
-    repo := strings.TrimSuffix(repoTokenize[len(repoTokenize)-1], ".git")
-    return owner, repo
-  }
-  return "", ""
-}
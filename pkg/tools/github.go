@@ -0,0 +1,20 @@
+package tools
+
+import "strings"
+
+// ParseGithubRepository returns the owner and the name of a GitHub repository
+// from its SSH or HTTPS URL.
+func ParseGithubRepository(repository string) (string, string) {
+  // https://github.com/appspero/kube-git.git
+  // git@github.com:appspero/kube-git.git
+  repoTokenize := strings.Split(repository, "/")
+  if len(repoTokenize) >= 2 {
+    owner := repoTokenize[len(repoTokenize)-2]
+    if len(strings.Split(owner, ":")) == 2 {
+      owner = strings.Split(owner, ":")[1]
+    }
+    repo := strings.TrimSuffix(repoTokenize[len(repoTokenize)-1], ".git")
+    return owner, repo
+  }
+  return "", ""
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+
+	argo "github.com/argoproj/argo/pkg/apis/workflow/v1alpha1"
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/controller"
+)
+
+// errRunning is returned by ApplyGitHook when the push is queued until the
+// resource of the previous push of the branch finished
+var errRunning = errors.New("the resource of a previous push of the branch is running")
+
+// errWaiting is returned when a push of the branch received before is not
+// applied yet, the pushes of a branch are applied in order
+var errWaiting = errors.New("a previous push of the branch is not applied yet")
+
+// checkConcurrency applies the concurrency policy of the GitHook with clients
+// before the resource of the push is created in namespace, and returns whether
+// it should be created. errRunning is returned for the Queue policy.
+func (h WebhookHandler) checkConcurrency(clients applyClients, gh *ghapi.GitHook, mapping *meta.RESTMapping, namespace string, annotations map[string]string) (bool, error) {
+
+	policy := gh.Spec.ConcurrencyPolicy
+	if policy == "" || policy == ghapi.AllowConcurrent {
+		return true, nil
+	}
+
+	ghFullname := annotations["kubegit.appspero.com/githook"]
+	branch := annotations["kubegit.appspero.com/branch"]
+	kind := mapping.GroupVersionKind.Kind
+
+	running, err := runningResources(clients, mapping, namespace, gh, branch)
+	if err != nil {
+		return false, fmt.Errorf("listing running %ss of GitHook %s: %s", kind, ghFullname, err)
+	}
+	if len(running) == 0 {
+		return true, nil
+	}
+
+	switch policy {
+	case ghapi.ForbidConcurrent:
+		klog.Infof("Skipping push of %s for GitHook %s, %s %s/%s is running", branch, ghFullname, kind, namespace, running[0])
+		h.recorder.Eventf(gh, corev1.EventTypeNormal, "ConcurrentRunForbidden", "Push %s of %s skipped, %s %s/%s is running", annotations["kubegit.appspero.com/commit"], branch, kind, namespace, running[0])
+		return false, nil
+
+	case ghapi.ReplaceConcurrent:
+		for _, name := range running {
+			klog.Infof("Stopping %s %s/%s of GitHook %s replaced by a push of %s", kind, namespace, name, ghFullname, branch)
+			if err := stopResource(clients, mapping, namespace, name); err != nil {
+				return false, fmt.Errorf("stopping %s %s/%s: %s", kind, namespace, name, err)
+			}
+			h.recorder.Eventf(gh, corev1.EventTypeNormal, "ConcurrentRunReplaced", "%s %s/%s stopped for push %s of %s", kind, namespace, name, annotations["kubegit.appspero.com/commit"], branch)
+		}
+		return true, nil
+
+	case ghapi.QueueConcurrent:
+		klog.Infof("Queueing push of %s for GitHook %s until %s %s/%s finished", branch, ghFullname, kind, namespace, running[0])
+		return false, errRunning
+	}
+
+	return false, fmt.Errorf("unknown concurrency policy %q", policy)
+}
+
+// runningResources returns the names of the running resources created in
+// namespace for the GitHook and branch
+func runningResources(clients applyClients, mapping *meta.RESTMapping, namespace string, gh *ghapi.GitHook, branch string) ([]string, error) {
+
+	opts := metav1.ListOptions{LabelSelector: controller.GitHookUIDLabel + "=" + string(gh.UID)}
+	created := func(annotations map[string]string) bool {
+		return annotations["kubegit.appspero.com/branch"] == branch
+	}
+
+	var names []string
+	switch mapping.GroupVersionKind.Kind {
+	case "Workflow":
+		list, err := clients.wfClientset.ArgoprojV1alpha1().Workflows(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, wf := range list.Items {
+			if created(wf.Annotations) && workflowRunning(&wf) {
+				names = append(names, wf.Name)
+			}
+		}
+
+	case "Job":
+		list, err := clients.clientset.BatchV1().Jobs(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range list.Items {
+			if created(job.Annotations) && jobRunning(&job) {
+				names = append(names, job.Name)
+			}
+		}
+
+	case "PipelineRun", "TaskRun":
+		list, err := clients.dynClientset.Resource(mapping.Resource).Namespace(namespace).List(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range list.Items {
+			if created(run.GetAnnotations()) && tektonRunning(&run) {
+				names = append(names, run.GetName())
+			}
+		}
+	}
+	return names, nil
+}
+
+// stopResource terminates a Workflow, deletes a Job with its pods, and cancels
+// a PipelineRun or TaskRun
+func stopResource(clients applyClients, mapping *meta.RESTMapping, namespace string, name string) error {
+
+	switch mapping.GroupVersionKind.Kind {
+	case "Workflow":
+		// same as argo terminate
+		patch := []byte(`{"spec":{"activeDeadlineSeconds":0}}`)
+		_, err := clients.wfClientset.ArgoprojV1alpha1().Workflows(namespace).Patch(name, types.MergePatchType, patch)
+		return err
+
+	case "Job":
+		propagation := metav1.DeletePropagationBackground
+		return clients.clientset.BatchV1().Jobs(namespace).Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+
+	case "PipelineRun", "TaskRun":
+		patch := []byte(fmt.Sprintf(`{"spec":{"status":"%sCancelled"}}`, mapping.GroupVersionKind.Kind))
+		_, err := clients.dynClientset.Resource(mapping.Resource).Namespace(namespace).Patch(name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	}
+	return nil
+}
+
+func workflowRunning(wf *argo.Workflow) bool {
+	return !wf.Status.Completed()
+}
+
+func jobRunning(job *batch.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batch.JobComplete || condition.Type == batch.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
+
+func tektonRunning(run *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(run.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Succeeded" {
+			return condition["status"] == "Unknown"
+		}
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// the key of the ConfigMap data the deliveries are persisted in
+	deliveriesKey = "deliveries"
+	// maxDeliveryStoreSize bounds the size of the persisted deliveries, a
+	// ConfigMap can't be bigger than 1MiB. The oldest deliveries are not
+	// persisted above it.
+	maxDeliveryStoreSize = 900 * 1024
+)
+
+// delivery is a received push, kept until it expires
+type delivery struct {
+	Delivery string `json:"delivery"`
+	// Commit is the repository, ref and commit of the push
+	Commit  string    `json:"commit"`
+	Expires time.Time `json:"expires"`
+}
+
+// keys are the keys of the cache entries of the delivery
+func (d *delivery) keys() []string {
+	var keys []string
+	if d.Delivery != "" {
+		keys = append(keys, "delivery/"+d.Delivery)
+	}
+	if d.Commit != "" {
+		keys = append(keys, "commit/"+d.Commit)
+	}
+	return keys
+}
+
+// DeliveryCache remembers the pushes received for a while, so the webhooks
+// redelivered by GitHub (eg., after a timeout) are not applied twice. A push is
+// a duplicate if its delivery ID or its repository, ref and commit were already
+// received.
+type DeliveryCache struct {
+	ttl  time.Duration
+	size int
+
+	mu sync.Mutex
+	// entries are the deliveries by delivery ID and by commit
+	entries map[string]*list.Element
+	// order of the deliveries from the oldest, evicted first above size
+	order *list.List
+
+	// store persists the deliveries, nil if they are only kept in memory
+	store *DeliveryStore
+}
+
+// NewDeliveryCache creates a cache of the pushes received for ttl, keeping at
+// most size of them
+func NewDeliveryCache(ttl time.Duration, size int, store *DeliveryStore) *DeliveryCache {
+	return &DeliveryCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		store:   store,
+	}
+}
+
+func newDelivery(event pushEvent, expires time.Time) *delivery {
+	return &delivery{
+		Delivery: event.Delivery,
+		Commit:   event.CloneURL + "/" + event.Branch + "/" + event.Commit,
+		Expires:  expires,
+	}
+}
+
+// add remembers the push, or returns why it is a duplicate if it was already
+// received
+func (c *DeliveryCache) add(event pushEvent) string {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	d := newDelivery(event, now.Add(c.ttl))
+	if el, ok := c.entries["delivery/"+d.Delivery]; ok && d.Delivery != "" {
+		return fmt.Sprintf("delivery %s was already received", el.Value.(*delivery).Delivery)
+	}
+	if el, ok := c.entries["commit/"+d.Commit]; ok {
+		return fmt.Sprintf("commit %s of %s was already received in delivery %s", event.Commit, event.Branch, el.Value.(*delivery).Delivery)
+	}
+
+	c.insert(d)
+	return ""
+}
+
+// remove forgets the push, so it is accepted if redelivered
+func (c *DeliveryCache) remove(event pushEvent) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range newDelivery(event, time.Time{}).keys() {
+		if el, ok := c.entries[key]; ok {
+			c.delete(el)
+		}
+	}
+}
+
+func (c *DeliveryCache) insert(d *delivery) {
+	el := c.order.PushBack(d)
+	for _, key := range d.keys() {
+		c.entries[key] = el
+	}
+	for c.size > 0 && c.order.Len() > c.size {
+		c.delete(c.order.Front())
+	}
+}
+
+func (c *DeliveryCache) delete(el *list.Element) {
+	c.order.Remove(el)
+	for _, key := range el.Value.(*delivery).keys() {
+		if c.entries[key] == el {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// known returns whether a key of the delivery is in the cache
+func (c *DeliveryCache) known(d *delivery) bool {
+	for _, key := range d.keys() {
+		if _, ok := c.entries[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *DeliveryCache) expire(now time.Time) {
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if now.After(el.Value.(*delivery).Expires) {
+			c.delete(el)
+		}
+		el = next
+	}
+}
+
+// Sync merges the deliveries persisted by the replicas with the deliveries of
+// this replica, and persists them. It does nothing without a store.
+func (c *DeliveryCache) Sync() error {
+
+	if c.store == nil {
+		return nil
+	}
+
+	return c.store.update(func(cm *corev1.ConfigMap) bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		now := time.Now()
+		if data, ok := cm.Data[deliveriesKey]; ok {
+			var persisted []delivery
+			if err := json.Unmarshal([]byte(data), &persisted); err != nil {
+				klog.Errorf("Dropping invalid deliveries of the delivery store: %s", err.Error())
+			}
+			for i := range persisted {
+				d := persisted[i]
+				if c.known(&d) || len(d.keys()) == 0 || now.After(d.Expires) {
+					continue
+				}
+				c.insert(&d)
+			}
+		}
+		c.expire(now)
+
+		// persist the newest deliveries that fit in the ConfigMap
+		var deliveries []delivery
+		size := 0
+		for el := c.order.Back(); el != nil; el = el.Prev() {
+			d := *el.Value.(*delivery)
+			b, err := json.Marshal(d)
+			if err != nil {
+				klog.Errorf("Error encoding delivery %s: %s", d.Delivery, err.Error())
+				continue
+			}
+			if size += len(b) + 1; size > maxDeliveryStoreSize {
+				break
+			}
+			deliveries = append(deliveries, d)
+		}
+		for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+			deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+		}
+		if deliveries == nil {
+			deliveries = []delivery{}
+		}
+		b, err := json.Marshal(deliveries)
+		if err != nil {
+			klog.Errorf("Error encoding deliveries: %s", err.Error())
+			return false
+		}
+		if cm.Data[deliveriesKey] == string(b) {
+			return false
+		}
+		cm.Data[deliveriesKey] = string(b)
+		return true
+	})
+}
+
+// DeliveryStore persists the deliveries received by the replicas in a ConfigMap,
+// so the duplicates are still detected after a restart or by another replica
+type DeliveryStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewDeliveryStore creates a store in the ConfigMap namespace/name
+func NewDeliveryStore(clientset kubernetes.Interface, namespace string, name string) *DeliveryStore {
+	return &DeliveryStore{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *DeliveryStore) update(mutate func(cm *corev1.ConfigMap) bool) error {
+	return updateConfigMap(s.clientset, s.namespace, s.name, mutate)
+}
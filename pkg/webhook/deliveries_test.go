@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPush(delivery string, commit string) pushEvent {
+	return pushEvent{
+		Delivery: delivery,
+		CloneURL: "https://github.com/appspero/kube-git.git",
+		Branch:   "refs/heads/master",
+		Commit:   commit,
+	}
+}
+
+func TestDeliveryCacheDuplicates(t *testing.T) {
+	c := NewDeliveryCache(time.Hour, 0, nil)
+
+	if reason := c.add(newTestPush("1", "a")); reason != "" {
+		t.Fatalf("got duplicate %q for the first push", reason)
+	}
+
+	tests := []struct {
+		name  string
+		event pushEvent
+		want  string
+	}{
+		{name: "same delivery", event: newTestPush("1", "b"), want: "delivery 1 was already received"},
+		{name: "same commit", event: newTestPush("2", "a"), want: "already received in delivery 1"},
+		{name: "new push", event: newTestPush("3", "c")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason := c.add(test.event)
+			if test.want == "" && reason != "" || !strings.Contains(reason, test.want) {
+				t.Errorf("got duplicate %q, want %q", reason, test.want)
+			}
+		})
+	}
+
+	c.remove(newTestPush("1", "a"))
+	if reason := c.add(newTestPush("1", "a")); reason != "" {
+		t.Errorf("got duplicate %q for a removed push", reason)
+	}
+}
+
+func TestDeliveryCacheSize(t *testing.T) {
+	c := NewDeliveryCache(time.Hour, 2, nil)
+
+	for _, d := range []string{"1", "2", "3"} {
+		if reason := c.add(newTestPush(d, d)); reason != "" {
+			t.Fatalf("got duplicate %q", reason)
+		}
+	}
+	// the size counts the deliveries, not their delivery and commit entries
+	if c.order.Len() != 2 || len(c.entries) != 4 {
+		t.Fatalf("got %d deliveries and %d entries, want 2 and 4", c.order.Len(), len(c.entries))
+	}
+	if reason := c.add(newTestPush("1", "1")); reason != "" {
+		t.Errorf("got duplicate %q for the evicted push", reason)
+	}
+	if reason := c.add(newTestPush("3", "3")); reason == "" {
+		t.Error("got no duplicate for the newest push")
+	}
+}
+
+func TestDeliveryCacheExpire(t *testing.T) {
+	c := NewDeliveryCache(-time.Second, 0, nil)
+
+	c.add(newTestPush("1", "a"))
+	if reason := c.add(newTestPush("1", "a")); reason != "" {
+		t.Errorf("got duplicate %q for an expired push", reason)
+	}
+}
+
+func TestDeliveryCacheSync(t *testing.T) {
+	store := NewDeliveryStore(fake.NewSimpleClientset(), "kube-git", "kube-git-deliveries")
+	a := NewDeliveryCache(time.Hour, 0, store)
+	b := NewDeliveryCache(time.Hour, 0, store)
+
+	a.add(newTestPush("1", "a"))
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	b.add(newTestPush("2", "b"))
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]*DeliveryCache{"a": a, "b": b} {
+		for _, event := range []pushEvent{newTestPush("1", "a"), newTestPush("2", "b")} {
+			if reason := c.add(event); reason == "" {
+				t.Errorf("got no duplicate for delivery %s in replica %s", event.Delivery, name)
+			}
+		}
+	}
+}
+
+func TestDeliveryCacheSyncSize(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := NewDeliveryCache(time.Hour, 0, NewDeliveryStore(clientset, "kube-git", "kube-git-deliveries"))
+
+	commit := strings.Repeat("0", 40)
+	n := 2 * maxDeliveryStoreSize / 150
+	for i := 0; i < n; i++ {
+		c.add(newTestPush(fmt.Sprintf("%036d", i), fmt.Sprintf("%s%d", commit, i)))
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("kube-git").Get("kube-git-deliveries", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := cm.Data[deliveriesKey]
+	if len(data) > maxDeliveryStoreSize {
+		t.Fatalf("got %d bytes of deliveries, want at most %d", len(data), maxDeliveryStoreSize)
+	}
+	var persisted []delivery
+	if err := json.Unmarshal([]byte(data), &persisted); err != nil {
+		t.Fatal(err)
+	}
+	if len(persisted) == 0 || len(persisted) == n {
+		t.Fatalf("got %d persisted deliveries of %d, want the newest that fit", len(persisted), n)
+	}
+	if last := persisted[len(persisted)-1].Delivery; last != fmt.Sprintf("%036d", n-1) {
+		t.Errorf("got newest persisted delivery %s, want the newest delivery", last)
+	}
+	// the in memory cache keeps all the deliveries
+	if c.order.Len() != n {
+		t.Errorf("got %d deliveries in memory, want %d", c.order.Len(), n)
+	}
+}
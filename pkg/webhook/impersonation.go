@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"fmt"
+
+	wfclient "github.com/argoproj/argo/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// applyClients are the clients creating the resources of a GitHook
+type applyClients struct {
+	clientset    kubernetes.Interface
+	wfClientset  wfclient.Interface
+	dynClientset dynamic.Interface
+}
+
+// defaultServiceAccount is impersonated for the GitHooks without a
+// ServiceAccount, the controller never creates the resources with its own RBAC
+const defaultServiceAccount = "default"
+
+// applyClients returns the clients impersonating the ServiceAccount of the
+// GitHook, or the default ServiceAccount of its namespace, so the RBAC of the
+// ServiceAccount decides what the pushed manifests may create
+func (h WebhookHandler) applyClients(gh *ghapi.GitHook) (applyClients, error) {
+
+	serviceAccount := gh.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+
+	// the ServiceAccount is always the one of the namespace of the GitHook
+	config := rest.CopyConfig(h.config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: fmt.Sprintf("system:serviceaccount:%s:%s", gh.Namespace, serviceAccount),
+	}
+
+	var c applyClients
+	var err error
+	if c.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return c, err
+	}
+	if c.wfClientset, err = wfclient.NewForConfig(config); err != nil {
+		return c, err
+	}
+	if c.dynClientset, err = dynamic.NewForConfig(config); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// createFailed reports a resource the ServiceAccount of the GitHook isn't
+// allowed to create
+func (h WebhookHandler) createFailed(gh *ghapi.GitHook, kind string, namespace string, err error) {
+	if errors.IsForbidden(err) {
+		h.recorder.Event(gh, corev1.EventTypeWarning, "CreateForbidden", fmt.Sprintf("%s not created in namespace %s: %s", kind, namespace, err))
+	}
+}
@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// branchLeaseDuration is how long the Lease of a branch is held without being
+// renewed, the Lease of a replica that stopped is taken over after it
+const branchLeaseDuration = time.Minute
+
+// BranchLocks serialise the pushes of a branch of a GitHook across the
+// replicas, so the concurrency policy sees the resource of the previous push.
+// A branch is locked with a Lease in the namespace of the pod, held by the
+// replica applying a push of the branch.
+type BranchLocks struct {
+	clientset kubernetes.Interface
+	namespace string
+	// identity is the name of the pod of this replica
+	identity string
+
+	mu sync.Mutex
+	// local serialises the workers of this replica
+	local map[string]*sync.Mutex
+}
+
+// NewBranchLocks creates the locks of the replica running in the pod identity,
+// with Leases in namespace
+func NewBranchLocks(clientset kubernetes.Interface, namespace string, identity string) *BranchLocks {
+	return &BranchLocks{
+		clientset: clientset,
+		namespace: namespace,
+		identity:  identity,
+		local:     make(map[string]*sync.Mutex),
+	}
+}
+
+// tryLock locks the branch and returns the func unlocking it, or false if
+// another replica holds the branch. The workers of this replica wait for each
+// other.
+func (l *BranchLocks) tryLock(branch string) (func(), bool, error) {
+
+	l.mu.Lock()
+	m, ok := l.local[branch]
+	if !ok {
+		m = &sync.Mutex{}
+		l.local[branch] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	lease, ok, err := l.acquire(branch)
+	if err != nil || !ok {
+		m.Unlock()
+		return nil, ok, err
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	renewed := make(chan *coordinationv1.Lease, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(branchLeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				renewed <- lease
+				return
+			case <-ticker.C:
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				updated, err := l.clientset.CoordinationV1().Leases(l.namespace).Update(lease)
+				if err != nil {
+					klog.Errorf("Error renewing Lease %s/%s of %s: %s", l.namespace, lease.Name, branch, err.Error())
+					continue
+				}
+				lease = updated
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		wg.Wait()
+		l.release(<-renewed)
+		m.Unlock()
+	}, true, nil
+}
+
+// acquire creates or takes over the Lease of the branch if no other replica
+// holds it. Conflicting updates of the replicas fail, the Lease is then held by
+// another replica.
+func (l *BranchLocks) acquire(branch string) (*coordinationv1.Lease, bool, error) {
+
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	name := branchLeaseName(branch)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(branchLeaseDuration.Seconds())
+
+	lease, err := leases.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease, err = leases.Create(&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.namespace,
+				Labels:      map[string]string{"k8s-app": "kube-git"},
+				Annotations: map[string]string{"kubegit.appspero.com/branch": branch},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		})
+		if errors.IsAlreadyExists(err) {
+			return nil, false, nil
+		}
+		return lease, err == nil, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" && *holder != l.identity &&
+		lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil &&
+		lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds)*time.Second).After(now.Time) {
+		return nil, false, nil
+	}
+
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	lease, err = leases.Update(lease)
+	if errors.IsConflict(err) {
+		return nil, false, nil
+	}
+	return lease, err == nil, err
+}
+
+// release deletes the Lease unless it was taken over by another replica
+func (l *BranchLocks) release(lease *coordinationv1.Lease) {
+	err := l.clientset.CoordinationV1().Leases(l.namespace).Delete(lease.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		klog.Errorf("Error releasing Lease %s/%s: %s", l.namespace, lease.Name, err.Error())
+	}
+}
+
+// branchLeaseName is a valid name of the Lease of any branch
+func branchLeaseName(branch string) string {
+	sum := sha256.Sum256([]byte(branch))
+	return "kube-git-branch-" + hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBranchLocks(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	a := NewBranchLocks(clientset, "kube-git", "a")
+	b := NewBranchLocks(clientset, "kube-git", "b")
+	branch := "default/githook/refs/heads/master"
+
+	unlock, ok, err := a.tryLock(branch)
+	if err != nil || !ok {
+		t.Fatalf("got locked %v and error %v, want the lock", ok, err)
+	}
+	if _, ok, err := b.tryLock(branch); err != nil || ok {
+		t.Fatalf("got locked %v and error %v for a branch locked by another replica", ok, err)
+	}
+	if _, ok, err := b.tryLock("default/githook/refs/heads/other"); err != nil || !ok {
+		t.Fatalf("got locked %v and error %v for another branch", ok, err)
+	}
+
+	unlock()
+	unlock, ok, err = b.tryLock(branch)
+	if err != nil || !ok {
+		t.Fatalf("got locked %v and error %v for a released branch", ok, err)
+	}
+	unlock()
+}
+
+func TestBranchLocksExpired(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	a := NewBranchLocks(clientset, "kube-git", "a")
+	b := NewBranchLocks(clientset, "kube-git", "b")
+	branch := "default/githook/refs/heads/master"
+
+	// a stopped without releasing the Lease
+	lease, ok, err := a.acquire(branch)
+	if err != nil || !ok {
+		t.Fatalf("got locked %v and error %v, want the lock", ok, err)
+	}
+	expired := metav1.NewMicroTime(time.Now().Add(-2 * branchLeaseDuration))
+	lease.Spec.RenewTime = &expired
+	if _, err := clientset.CoordinationV1().Leases("kube-git").Update(lease); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, ok, err := b.tryLock(branch)
+	if err != nil || !ok {
+		t.Fatalf("got locked %v and error %v for an expired Lease", ok, err)
+	}
+	unlock()
+}
+
+func TestQueuedEventBefore(t *testing.T) {
+	now := time.Now()
+	e := queuedEvent{Event: pushEvent{Delivery: "2", Branch: "refs/heads/master"}, Namespace: "default", Name: "githook", Received: now}
+
+	tests := []struct {
+		name  string
+		other queuedEvent
+		want  bool
+	}{
+		{name: "earlier", other: queuedEvent{Event: pushEvent{Delivery: "1", Branch: "refs/heads/master"}, Namespace: "default", Name: "githook", Received: now.Add(-time.Second)}, want: true},
+		{name: "later", other: queuedEvent{Event: pushEvent{Delivery: "3", Branch: "refs/heads/master"}, Namespace: "default", Name: "githook", Received: now.Add(time.Second)}},
+		{name: "same time", other: queuedEvent{Event: pushEvent{Delivery: "1", Branch: "refs/heads/master"}, Namespace: "default", Name: "githook", Received: now}, want: true},
+		{name: "other branch", other: queuedEvent{Event: pushEvent{Delivery: "1", Branch: "refs/heads/other"}, Namespace: "default", Name: "githook", Received: now.Add(-time.Second)}},
+		{name: "other GitHook", other: queuedEvent{Event: pushEvent{Delivery: "1", Branch: "refs/heads/master"}, Namespace: "default", Name: "other", Received: now.Add(-time.Second)}},
+		{name: "itself", other: e},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.other.before(e); got != test.want {
+				t.Errorf("got before %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/git"
+)
+
+// GetManifest returns the manifest of a GitHook for the pushed commit. The
+// manifest is taken from Spec.ManifestFrom if set, otherwise Spec.Manifest is
+// read from the repository.
+func (h WebhookHandler) GetManifest(gh *ghapi.GitHook, branch string, hash string) ([]byte, error) {
+
+	var keys []string
+	if gh.Spec.SignatureVerification != nil {
+		var err error
+		keys, err = h.getSignatureKeys(gh)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if gh.Spec.ManifestFrom != nil {
+		if len(keys) != 0 {
+			if err := h.verifyCommit(gh, branch, hash, keys); err != nil {
+				return nil, err
+			}
+		}
+		return h.getManifestFrom(gh)
+	}
+
+	auth, err := h.getAuth(gh)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchGitFile := git.FetchGitFile
+	if h.repositoryCache != nil {
+		fetchGitFile = h.repositoryCache.FetchGitFile
+	}
+	opts := git.FetchOptions{Submodules: gh.Spec.Submodules, LFS: gh.Spec.LFS, SignatureKeys: keys}
+	manifest, err := fetchGitFile(gh.Spec.Repository, branch, auth, hash, gh.Spec.Manifest, opts)
+	if err != nil {
+		switch err.(type) {
+		case *git.HostKeyError, *git.SignatureError:
+			return nil, err
+		}
+		// the content API can't verify the commit signature
+		if gh.Spec.ContentAPI == nil || len(keys) != 0 {
+			return nil, fmt.Errorf("fetching %s from git repository (%s): %s", gh.Spec.Manifest, gh.Spec.Repository, err.Error())
+		}
+		klog.Errorf("Error fetching %s from git repository (%s), falling back to %s content API: %s", gh.Spec.Manifest, gh.Spec.Repository, gh.Spec.ContentAPI.Provider, err.Error())
+		return h.fetchContentAPIFile(gh, auth.Password, hash)
+	}
+	return manifest, nil
+}
+
+// verifyCommit verifies the signature of the pushed commit of a GitHook which
+// doesn't read its manifest from the repository
+func (h WebhookHandler) verifyCommit(gh *ghapi.GitHook, branch string, hash string, keys []string) error {
+
+	auth, err := h.getAuth(gh)
+	if err != nil {
+		return err
+	}
+	if h.repositoryCache != nil {
+		return h.repositoryCache.VerifyCommit(gh.Spec.Repository, branch, auth, hash, keys)
+	}
+	return git.VerifyCommit(gh.Spec.Repository, branch, auth, hash, keys)
+}
+
+// getSignatureKeys reads the armored public keys of all the entries of the
+// signature verification Secret and ConfigMap
+func (h WebhookHandler) getSignatureKeys(gh *ghapi.GitHook) ([]string, error) {
+
+	var keys []string
+	source := gh.Spec.SignatureVerification
+
+	if source.Secret != "" {
+		secret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(source.Secret, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range secret.Data {
+			keys = append(keys, git.SplitArmoredKeys(string(data))...)
+		}
+	}
+
+	if source.ConfigMap != "" {
+		cm, err := h.clientset.CoreV1().ConfigMaps(gh.Namespace).Get(source.ConfigMap, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range cm.Data {
+			keys = append(keys, git.SplitArmoredKeys(data)...)
+		}
+	}
+
+	// without keys nothing would be verified
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no armored public keys found for signatureVerification")
+	}
+	return keys, nil
+}
+
+// getAuth gets the credentials and the known hosts of the repository of a GitHook
+func (h WebhookHandler) getAuth(gh *ghapi.GitHook) (git.Auth, error) {
+
+	var auth git.Auth
+
+	if ssh := gh.Spec.Auth.SSH; ssh != nil {
+		sshPrivateKeySecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(ssh.PrivateKeySecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return auth, err
+		}
+		auth.SshPrivateKey = sshPrivateKeySecret.Data[ssh.PrivateKeySecret.Key]
+		auth.SshUser = ssh.User
+
+		if ssh.PassphraseSecret != nil {
+			sshPassphraseSecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(ssh.PassphraseSecret.Name, metav1.GetOptions{})
+			if err != nil {
+				return auth, err
+			}
+			auth.SshPassphrase = sshPassphraseSecret.Data[ssh.PassphraseSecret.Key]
+		}
+
+		knownHosts, err := h.getKnownHosts(gh.Namespace, ssh)
+		if err != nil {
+			return auth, err
+		}
+		auth.KnownHosts = knownHosts
+		auth.InsecureIgnoreHostKey = ssh.InsecureIgnoreHostKey
+	}
+
+	// getting username and password from Secrets
+	if basic := gh.Spec.Auth.Basic; basic != nil {
+		usernameSecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(basic.UsernameSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return auth, err
+		}
+		passwordSecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(basic.PasswordSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return auth, err
+		}
+		auth.Username = usernameSecret.Data[basic.UsernameSecret.Key]
+		auth.Password = passwordSecret.Data[basic.PasswordSecret.Key]
+	} else if gh.Spec.Auth.GithubApp != "" {
+		githubConfig, ok := h.notificationConfig.Github[gh.Spec.Auth.GithubApp]
+		if !ok || githubConfig.App == nil {
+			return auth, fmt.Errorf("GitHub notification config %s with a GitHub App not found", gh.Spec.Auth.GithubApp)
+		}
+		if !githubConfig.AppAllowed(gh.Namespace) {
+			return auth, fmt.Errorf("GitHub App of GitHub notification config %s is not allowed in namespace %s", gh.Spec.Auth.GithubApp, gh.Namespace)
+		}
+		// the token is sent to the host of the repository
+		repository, err := url.Parse(gh.Spec.Repository)
+		if host := githubConfig.App.Host(); err != nil || repository.Scheme != "https" || host == "" || !strings.EqualFold(repository.Host, host) {
+			return auth, fmt.Errorf("repository %s is not an HTTPS repository of %s, the host of the GitHub App of GitHub notification config %s", gh.Spec.Repository, host, gh.Spec.Auth.GithubApp)
+		}
+		token, err := githubConfig.App.Token(gh.Spec.Repository)
+		if err != nil {
+			return auth, err
+		}
+		auth.Username = []byte("x-access-token")
+		auth.Password = []byte(token)
+	}
+
+	return auth, nil
+}
+
+// getKnownHosts concatenates the known_hosts file of the controller with the
+// known hosts of the Secret and ConfigMap of the SSH auth of a GitHook
+func (h WebhookHandler) getKnownHosts(namespace string, ssh *ghapi.SSHAuth) ([]byte, error) {
+
+	var knownHosts []byte
+
+	if h.knownHostsFile != "" {
+		data, err := ioutil.ReadFile(h.knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = append(knownHosts, data...)
+		knownHosts = append(knownHosts, '\n')
+	}
+
+	if ssh.KnownHostsSecret != nil {
+		secret, err := h.clientset.CoreV1().Secrets(namespace).Get(ssh.KnownHostsSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = append(knownHosts, secret.Data[ssh.KnownHostsSecret.Key]...)
+		knownHosts = append(knownHosts, '\n')
+	}
+
+	if ssh.KnownHostsConfigMap != nil {
+		cm, err := h.clientset.CoreV1().ConfigMaps(namespace).Get(ssh.KnownHostsConfigMap.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = append(knownHosts, cm.Data[ssh.KnownHostsConfigMap.Key]...)
+		knownHosts = append(knownHosts, '\n')
+	}
+
+	return knownHosts, nil
+}
+
+func (h WebhookHandler) fetchContentAPIFile(gh *ghapi.GitHook, token []byte, hash string) ([]byte, error) {
+
+	switch gh.Spec.ContentAPI.Provider {
+	case "github":
+		return git.FetchGithubFile(gh.Spec.ContentAPI.URL, gh.Spec.Repository, token, hash, gh.Spec.Manifest)
+	}
+	return nil, fmt.Errorf("unsupported content API provider: %s", gh.Spec.ContentAPI.Provider)
+}
+
+func (h WebhookHandler) getManifestFrom(gh *ghapi.GitHook) ([]byte, error) {
+
+	source := gh.Spec.ManifestFrom
+
+	if source.Inline != nil {
+		if len(source.Inline.Raw) == 0 {
+			return nil, fmt.Errorf("empty inline manifest")
+		}
+		return source.Inline.Raw, nil
+	}
+
+	if source.ConfigMap != nil {
+		cm, err := h.clientset.CoreV1().ConfigMaps(gh.Namespace).Get(source.ConfigMap.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := cm.Data[source.ConfigMap.Key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[source.ConfigMap.Key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", source.ConfigMap.Key, gh.Namespace, source.ConfigMap.Name)
+	}
+
+	return nil, fmt.Errorf("manifestFrom has neither inline nor configMap set")
+}
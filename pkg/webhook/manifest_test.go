@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/githubapp"
+	"github.com/appspero/kube-git/pkg/notification"
+)
+
+func TestGetAuthGithubAppHost(t *testing.T) {
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/appspero/kube-git/installation":
+			fmt.Fprint(w, `{"id": 1}`)
+		case "/app/installations/1/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	app, err := githubapp.NewApp(1, testAppKey(t), api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := WebhookHandler{notificationConfig: &notification.Config{Github: map[string]notification.GithubConfig{
+		"app": {App: app, AllowedNamespaces: []string{"ci"}},
+	}}}
+	host := strings.TrimPrefix(api.URL, "http://")
+
+	tests := []struct {
+		name       string
+		repository string
+		allowed    bool
+	}{
+		{name: "host of the App", repository: "https://" + host + "/appspero/kube-git.git", allowed: true},
+		{name: "other host", repository: "https://attacker.example/appspero/kube-git.git"},
+		{name: "other port", repository: "https://" + strings.Split(host, ":")[0] + "/appspero/kube-git.git"},
+		{name: "HTTP", repository: "http://" + host + "/appspero/kube-git.git"},
+		{name: "SSH", repository: "git@" + host + ":appspero/kube-git.git"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gh := &ghapi.GitHook{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "githook"},
+				Spec: ghapi.GitHookSpec{
+					Repository: test.repository,
+					Auth:       ghapi.AuthSpec{GithubApp: "app"},
+				},
+			}
+			auth, err := h.getAuth(gh)
+			if test.allowed {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(auth.Password) != "installation-token" {
+					t.Errorf("got password %q, want the installation token", auth.Password)
+				}
+				return
+			}
+			if err == nil || auth.Password != nil {
+				t.Errorf("got token %q, want an error", auth.Password)
+			}
+		})
+	}
+}
+
+func TestAppHost(t *testing.T) {
+
+	tests := []struct {
+		api  string
+		want string
+	}{
+		{api: "", want: "github.com"},
+		{api: "https://api.github.com/", want: "github.com"},
+		{api: "https://github.example.com/api/v3", want: "github.example.com"},
+	}
+
+	key := testAppKey(t)
+	for _, test := range tests {
+		app, err := githubapp.NewApp(1, key, test.api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := app.Host(); got != test.want {
+			t.Errorf("Host() of %q = %q, want %q", test.api, got, test.want)
+		}
+	}
+}
+
+// testAppKey returns a PEM private key of a GitHub App
+func testAppKey(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+// Policy restricts the resources the manifests of all the GitHooks may create
+type Policy struct {
+	// Namespaces the resources may be created in besides the namespace of their
+	// GitHook, none if empty and any namespace if it contains "*"
+	Namespaces []string
+	// Kinds of the resources, any supported kind if empty
+	Kinds []string
+}
+
+// allowed checks the kind and namespace of the resource of a manifest against
+// the cluster policy and the GitHook, and records an Event on the GitHook if
+// it's not allowed
+func (h WebhookHandler) allowed(gh *ghapi.GitHook, kind string, namespace string) bool {
+
+	ghFullname := gh.Namespace + "/" + gh.Name
+
+	if !contains(h.policy.Kinds, kind) || !contains(gh.Spec.AllowedKinds, kind) {
+		klog.Warningf("Not creating %s of GitHook %s, the kind is not allowed", kind, ghFullname)
+		h.recorder.Event(gh, corev1.EventTypeWarning, "KindNotAllowed", fmt.Sprintf("%s is not an allowed kind", kind))
+		return false
+	}
+
+	// the namespace of the GitHook is always allowed
+	clusterAllowed := namespace == gh.Namespace || (len(h.policy.Namespaces) > 0 && (contains(h.policy.Namespaces, "*") || contains(h.policy.Namespaces, namespace)))
+	gitHookAllowed := namespace == gh.Namespace || contains(gh.Spec.AllowedNamespaces, namespace)
+	if !clusterAllowed || !gitHookAllowed {
+		klog.Warningf("Not creating %s of GitHook %s in namespace %s, the namespace is not allowed", kind, ghFullname, namespace)
+		h.recorder.Event(gh, corev1.EventTypeWarning, "NamespaceNotAllowed", fmt.Sprintf("%s can't be created in namespace %s", kind, namespace))
+		return false
+	}
+
+	return true
+}
+
+// contains returns whether value is in list, an empty list contains anything:
+// the GitHooks only restrict the cluster policy further
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+)
+
+func TestPolicyAllowedNamespaces(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		cluster   []string
+		githook   []string
+		namespace string
+		want      bool
+	}{
+		{name: "own namespace", namespace: "ci", want: true},
+		{name: "own namespace not in the GitHook list", githook: []string{"other"}, cluster: []string{"*"}, namespace: "ci", want: true},
+		{name: "no cluster namespaces", namespace: "other"},
+		{name: "cluster namespace", cluster: []string{"other"}, namespace: "other", want: true},
+		{name: "any cluster namespace", cluster: []string{"*"}, namespace: "other", want: true},
+		{name: "not a cluster namespace", cluster: []string{"another"}, namespace: "other"},
+		{name: "GitHook namespace", cluster: []string{"*"}, githook: []string{"other"}, namespace: "other", want: true},
+		{name: "not a GitHook namespace", cluster: []string{"*"}, githook: []string{"another"}, namespace: "other"},
+		{name: "GitHook namespace not allowed by the cluster", githook: []string{"other"}, namespace: "other"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := WebhookHandler{policy: Policy{Namespaces: test.cluster}, recorder: record.NewFakeRecorder(1)}
+			gh := &ghapi.GitHook{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "githook"},
+				Spec:       ghapi.GitHookSpec{AllowedNamespaces: test.githook},
+			}
+			if got := h.allowed(gh, "Job", test.namespace); got != test.want {
+				t.Errorf("got allowed %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
+	"github.com/appspero/kube-git/pkg/git"
+	"github.com/appspero/kube-git/pkg/metrics"
+)
+
+const (
+	// a push is fetched and applied this many times before giving up
+	maxEventRetries = 5
+	// the deliveries are merged with the delivery store this often
+	deliverySyncPeriod = 30 * time.Second
+	// a push queued by the concurrency policy checks the running resource this often
+	runningPollPeriod = 10 * time.Second
+	// the events of the replicas that are gone are adopted this often
+	eventAdoptPeriod = time.Minute
+)
+
+// pushEvent is a push normalized from the webhook payload
+type pushEvent struct {
+	// Delivery is the ID of the webhook delivery
+	Delivery string `json:"delivery"`
+	SSHURL   string `json:"sshURL"`
+	CloneURL string `json:"cloneURL"`
+	Branch   string `json:"branch"`
+	Commit   string `json:"commit"`
+	Author   string `json:"author"`
+}
+
+// queuedEvent is a push to process for a matching GitHook
+type queuedEvent struct {
+	Event     pushEvent `json:"event"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	// Owner is the replica processing the event
+	Owner string `json:"owner,omitempty"`
+	// Received orders the pushes of a branch
+	Received time.Time `json:"received"`
+}
+
+// before returns whether e is a push of the same GitHook and branch as other
+// received before it
+func (e queuedEvent) before(other queuedEvent) bool {
+	if e.key() == other.key() || e.Namespace != other.Namespace || e.Name != other.Name || e.Event.Branch != other.Event.Branch {
+		return false
+	}
+	if e.Received.Equal(other.Received) {
+		return e.key() < other.key()
+	}
+	return e.Received.Before(other.Received)
+}
+
+// key is unique for a push and a GitHook, and a valid ConfigMap key
+func (e queuedEvent) key() string {
+	return e.Event.Delivery + "." + e.Namespace + "." + e.Name
+}
+
+// eventQueue is the rate limited queue of the pushes to process, the workers
+// fetch the manifests and apply them outside of the webhook requests
+type eventQueue struct {
+	queue workqueue.RateLimitingInterface
+
+	mu      sync.Mutex
+	pending map[string]queuedEvent
+
+	// store persists the pending events, nil if they are only kept in memory
+	store *EventStore
+	// locks are held by the worker applying a push of a branch
+	locks *BranchLocks
+
+	workers  sync.WaitGroup
+	stopping chan struct{}
+}
+
+func newEventQueue(store *EventStore, locks *BranchLocks) *eventQueue {
+	return &eventQueue{
+		queue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "webhook-events"),
+		pending:  make(map[string]queuedEvent),
+		store:    store,
+		locks:    locks,
+		stopping: make(chan struct{}),
+	}
+}
+
+// waiting returns whether a push of the same GitHook and branch received
+// before e isn't applied yet, by this replica or by another one
+func (q *eventQueue) waiting(e queuedEvent) (bool, error) {
+
+	q.mu.Lock()
+	for _, other := range q.pending {
+		if other.before(e) {
+			q.mu.Unlock()
+			return true, nil
+		}
+	}
+	q.mu.Unlock()
+
+	if q.store == nil {
+		return false, nil
+	}
+	stored, err := q.store.List()
+	if err != nil {
+		return false, err
+	}
+	for _, other := range stored {
+		if other.before(e) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchGitHooks returns the GitHooks of the repository and branch of the push
+func (h WebhookHandler) matchGitHooks(event pushEvent) []*ghapi.GitHook {
+
+	var ghs []*ghapi.GitHook
+	for _, gh := range h.controller.GetGitHooksByRepository(event.SSHURL, event.CloneURL) {
+		ghFullname := gh.Namespace + "/" + gh.Name
+		klog.Infof("Found GitHook for GitHub payload: %s", ghFullname)
+
+		// if no matched branch, continue
+		if !MatchBranch(gh.Spec.Branches, event.Branch) {
+			klog.Infof("No branches matched the found GitHook '%s' branchs: %s", ghFullname, event.Branch)
+			continue
+		}
+		metrics.GitHookMatches.WithLabelValues(gh.Namespace, gh.Name).Inc()
+		ghs = append(ghs, gh)
+	}
+	return ghs
+}
+
+// enqueue queues the push for the GitHooks and returns how many were queued
+func (h WebhookHandler) enqueue(event pushEvent, ghs []*ghapi.GitHook) (int, error) {
+
+	count := 0
+	for _, gh := range ghs {
+		e := queuedEvent{Event: event, Namespace: gh.Namespace, Name: gh.Name, Received: time.Now()}
+		if h.events.store != nil {
+			if err := h.events.store.Add(e.key(), e); err != nil {
+				return count, fmt.Errorf("persisting push %s for GitHook %s/%s: %s", event.Delivery, gh.Namespace, gh.Name, err)
+			}
+		}
+		h.events.mu.Lock()
+		h.events.pending[e.key()] = e
+		h.events.mu.Unlock()
+		h.events.queue.Add(e.key())
+		count++
+	}
+	return count, nil
+}
+
+// Run queues the persisted events of this replica and of the replicas that
+// don't exist anymore, and starts the workers. The events of the replicas
+// that stop later on are adopted periodically.
+func (h WebhookHandler) Run(workers int) error {
+
+	if h.events.store != nil {
+		events, err := h.events.store.Recover()
+		if err != nil {
+			return err
+		}
+		h.events.resume(events)
+		go wait.Until(func() {
+			events, err := h.events.store.Adopt()
+			if err != nil {
+				klog.Errorf("Error adopting the pushes of the event store: %s", err.Error())
+				return
+			}
+			h.events.resume(events)
+		}, eventAdoptPeriod, h.events.stopping)
+	}
+
+	if h.deliveries != nil {
+		if err := h.deliveries.Sync(); err != nil {
+			klog.Errorf("Error loading the deliveries of the delivery store: %s", err.Error())
+		}
+		go wait.Until(func() {
+			if err := h.deliveries.Sync(); err != nil {
+				klog.Errorf("Error syncing the delivery store: %s", err.Error())
+			}
+		}, deliverySyncPeriod, h.events.stopping)
+	}
+
+	klog.Infof("Starting %d webhook workers", workers)
+	for i := 0; i < workers; i++ {
+		h.events.workers.Add(1)
+		go func() {
+			defer h.events.workers.Done()
+			for h.processNextEvent() {
+			}
+		}()
+	}
+	return nil
+}
+
+// Wait stops the workers once the events being processed are done, until ctx
+// is done. The queued events are left in the store for the next start, without
+// a store they are processed before returning.
+func (h WebhookHandler) Wait(ctx context.Context) error {
+
+	close(h.events.stopping)
+	h.events.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		h.events.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("pushes still being processed: %s", ctx.Err())
+	}
+	if h.deliveries != nil {
+		return h.deliveries.Sync()
+	}
+	return nil
+}
+
+// resume queues the events recovered from the store that aren't queued yet
+func (q *eventQueue) resume(events map[string]queuedEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, e := range events {
+		if _, ok := q.pending[key]; ok {
+			continue
+		}
+		klog.Infof("Resuming push %s of %s for GitHook %s/%s", e.Event.Delivery, e.Event.Branch, e.Namespace, e.Name)
+		q.pending[key] = e
+		q.queue.Add(key)
+	}
+}
+
+func (h WebhookHandler) processNextEvent() bool {
+	key, quit := h.events.queue.Get()
+	if quit {
+		return false
+	}
+	defer h.events.queue.Done(key)
+
+	select {
+	case <-h.events.stopping:
+		if h.events.store != nil {
+			// left in the store
+			return true
+		}
+	default:
+	}
+
+	h.events.mu.Lock()
+	e, ok := h.events.pending[key.(string)]
+	h.events.mu.Unlock()
+	if !ok {
+		h.events.queue.Forget(key)
+		return true
+	}
+
+	err := h.processEvent(e)
+	if err == errRunning || err == errWaiting {
+		// not a failure, wait for the running resource or the previous push
+		h.events.queue.AddAfter(key, runningPollPeriod)
+		return true
+	}
+	if err != nil && h.events.queue.NumRequeues(key) < maxEventRetries {
+		klog.Infof("Error processing push %s for GitHook %s/%s (will retry): %v", e.Event.Delivery, e.Namespace, e.Name, err)
+		h.events.queue.AddRateLimited(key)
+		return true
+	}
+	if err != nil {
+		klog.Errorf("Error processing push %s for GitHook %s/%s (giving up): %v", e.Event.Delivery, e.Namespace, e.Name, err)
+		runtime.HandleError(err)
+		h.giveUp(e, err)
+	}
+
+	h.events.queue.Forget(key)
+	h.events.mu.Lock()
+	delete(h.events.pending, key.(string))
+	h.events.mu.Unlock()
+	if h.events.store != nil {
+		if err := h.events.store.Remove(key.(string)); err != nil {
+			klog.Errorf("Error removing push %s from the event store: %s", key, err.Error())
+		}
+	}
+	return true
+}
+
+// processEvent fetches the manifest of the GitHook for the push and applies it.
+// An error is returned if the manifest can't be fetched for now, the errors
+// that won't go away by retrying are reported on the GitHook instead.
+func (h WebhookHandler) processEvent(e queuedEvent) error {
+
+	gh, ok := h.controller.GetGitHook(e.Namespace, e.Name)
+	if !ok || gh.DeletionTimestamp != nil {
+		klog.Infof("GitHook %s/%s of push %s was deleted", e.Namespace, e.Name, e.Event.Delivery)
+		return nil
+	}
+	// the GitHook is from the informer cache
+	gh = gh.DeepCopy()
+	ghFullname := gh.Namespace + "/" + gh.Name
+	annotations := e.annotations(gh)
+
+	// the pushes of a branch are applied one at a time and in the order they
+	// were received, for the concurrency policy to see the resource of the
+	// previous push
+	if gh.Spec.ConcurrencyPolicy != "" && gh.Spec.ConcurrencyPolicy != ghapi.AllowConcurrent {
+		unlock, locked, err := h.events.locks.tryLock(ghFullname + "/" + e.Event.Branch)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			klog.Infof("Waiting for another replica applying a push of %s for GitHook %s", e.Event.Branch, ghFullname)
+			return errWaiting
+		}
+		defer unlock()
+
+		waiting, err := h.events.waiting(e)
+		if err != nil {
+			return err
+		}
+		if waiting {
+			klog.Infof("Waiting for a previous push of %s for GitHook %s", e.Event.Branch, ghFullname)
+			return errWaiting
+		}
+	}
+
+	manifest, err := h.GetManifest(gh, e.Event.Branch, e.Event.Commit)
+	if err != nil {
+		klog.Errorf("Error getting manifest of GitHook (%s): %s", ghFullname, err.Error())
+		if hostKeyErr, ok := err.(*git.HostKeyError); ok {
+			setGitHookCondition(&gh.Status, ghapi.GitHookCondition{
+				Type:    ghapi.HostKeyVerified,
+				Status:  corev1.ConditionFalse,
+				Reason:  "HostKeyVerificationFailed",
+				Message: hostKeyErr.Error(),
+			})
+			h.UpdateGitHookStatus(gh)
+			return nil
+		}
+		if signatureErr, ok := err.(*git.SignatureError); ok {
+			setGitHookCondition(&gh.Status, ghapi.GitHookCondition{
+				Type:    ghapi.SignatureVerified,
+				Status:  corev1.ConditionFalse,
+				Reason:  "SignatureVerificationFailed",
+				Message: signatureErr.Error(),
+			})
+			h.UpdateGitHookStatus(gh)
+			h.recorder.Event(gh, corev1.EventTypeWarning, "SignatureVerificationFailed", signatureErr.Error())
+			h.notifyFailed(gh, annotations)
+			return nil
+		}
+		return err
+	}
+	if gh.Spec.SignatureVerification != nil {
+		setGitHookCondition(&gh.Status, ghapi.GitHookCondition{
+			Type:   ghapi.SignatureVerified,
+			Status: corev1.ConditionTrue,
+			Reason: "SignatureVerified",
+		})
+	}
+	if getGitHookCondition(gh.Status, ghapi.HostKeyVerified) != nil && gh.Spec.ManifestFrom == nil {
+		setGitHookCondition(&gh.Status, ghapi.GitHookCondition{
+			Type:   ghapi.HostKeyVerified,
+			Status: corev1.ConditionTrue,
+			Reason: "HostKeyVerified",
+		})
+	}
+
+	klog.Infof("Applying GitHook of GitHub payload: %s", ghFullname)
+	return h.ApplyGitHook(manifest, gh, annotations)
+}
+
+// giveUp reports a push that couldn't be processed after all the retries
+func (h WebhookHandler) giveUp(e queuedEvent, err error) {
+
+	gh, ok := h.controller.GetGitHook(e.Namespace, e.Name)
+	if !ok {
+		return
+	}
+	gh = gh.DeepCopy()
+	h.recorder.Eventf(gh, corev1.EventTypeWarning, "ManifestFetchFailed", "Push of %s on %s not applied: %s", e.Event.Commit, e.Event.Branch, err)
+	h.notifyFailed(gh, e.annotations(gh))
+}
+
+// annotations are the status annotations of the resources applied for the push
+func (e queuedEvent) annotations(gh *ghapi.GitHook) map[string]string {
+	annotations := make(map[string]string)
+	annotations["kubegit.appspero.com/branch"] = e.Event.Branch
+	annotations["kubegit.appspero.com/commit"] = e.Event.Commit
+	annotations["kubegit.appspero.com/author"] = e.Event.Author
+	annotations["kubegit.appspero.com/githook"] = gh.Namespace + "/" + gh.Name
+	annotations["kubegit.appspero.com/repository"] = gh.Spec.Repository
+	return annotations
+}
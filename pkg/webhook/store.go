@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+// maxEventStoreSize bounds the size of the events of the store, a ConfigMap
+// can't be bigger than 1MiB
+const maxEventStoreSize = 900 * 1024
+
+// EventStore persists the pending pushes in a ConfigMap shared by the replicas,
+// so the pushes received but not applied yet are applied after a restart. A
+// push is owned by the replica that received it, the pushes of replicas that
+// don't exist anymore are adopted by the other replicas.
+type EventStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	// identity is the name of the pod of this replica
+	identity string
+}
+
+// NewEventStore creates a store in the ConfigMap namespace/name for the
+// replica running in the pod identity
+func NewEventStore(clientset kubernetes.Interface, namespace string, name string, identity string) *EventStore {
+	return &EventStore{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+	}
+}
+
+// Add persists the event owned by this replica, it fails if the store is full
+func (s *EventStore) Add(key string, e queuedEvent) error {
+
+	e.Owner = s.identity
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var full error
+	err = s.update(func(cm *corev1.ConfigMap) bool {
+		full = nil
+		size := len(key) + len(data)
+		for k, v := range cm.Data {
+			if k != key {
+				size += len(k) + len(v)
+			}
+		}
+		if size > maxEventStoreSize {
+			full = fmt.Errorf("event store %s/%s is full", s.namespace, s.name)
+			return false
+		}
+		cm.Data[key] = string(data)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return full
+}
+
+// Remove removes a processed event
+func (s *EventStore) Remove(key string) error {
+	return s.update(func(cm *corev1.ConfigMap) bool {
+		if _, ok := cm.Data[key]; !ok {
+			return false
+		}
+		delete(cm.Data, key)
+		return true
+	})
+}
+
+// List returns the events of all the replicas
+func (s *EventStore) List() (map[string]queuedEvent, error) {
+
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := make(map[string]queuedEvent)
+	for key, data := range cm.Data {
+		var e queuedEvent
+		if err := json.Unmarshal([]byte(data), &e); err == nil {
+			events[key] = e
+		}
+	}
+	return events, nil
+}
+
+// Recover returns the events of this replica and adopts the events of the
+// replicas whose pod doesn't exist anymore
+func (s *EventStore) Recover() (map[string]queuedEvent, error) {
+	return s.adopt(true)
+}
+
+// Adopt returns the events of the replicas whose pod doesn't exist anymore
+// after adopting them, eg. the events left by a replica replaced by a rolling
+// update after this replica started
+func (s *EventStore) Adopt() (map[string]queuedEvent, error) {
+	return s.adopt(false)
+}
+
+// adopt adopts the events of the replicas whose pod doesn't exist anymore and
+// returns them, with the events of this replica if own is true
+func (s *EventStore) adopt(own bool) (map[string]queuedEvent, error) {
+
+	var events map[string]queuedEvent
+	owners := make(map[string]bool)
+
+	err := s.update(func(cm *corev1.ConfigMap) bool {
+		events = make(map[string]queuedEvent)
+		adopted := false
+		for key, data := range cm.Data {
+			var e queuedEvent
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				klog.Errorf("Dropping invalid event %s of the event store: %s", key, err.Error())
+				delete(cm.Data, key)
+				adopted = true
+				continue
+			}
+			if e.Owner != s.identity {
+				alive, ok := owners[e.Owner]
+				if !ok {
+					alive = s.podExists(e.Owner)
+					owners[e.Owner] = alive
+				}
+				if alive {
+					continue
+				}
+				klog.Infof("Adopting push %s for GitHook %s/%s of replica %s", e.Event.Delivery, e.Namespace, e.Name, e.Owner)
+				e.Owner = s.identity
+				b, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				cm.Data[key] = string(b)
+				adopted = true
+			} else if !own {
+				continue
+			}
+			events[key] = e
+		}
+		return adopted
+	})
+	return events, err
+}
+
+func (s *EventStore) podExists(name string) bool {
+	_, err := s.clientset.CoreV1().Pods(s.namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		// keep the events of the replica if we don't know
+		klog.Errorf("Error getting pod %s of the event store: %s", name, err.Error())
+	}
+	return true
+}
+
+// update applies mutate to the ConfigMap of the store
+func (s *EventStore) update(mutate func(cm *corev1.ConfigMap) bool) error {
+	return updateConfigMap(s.clientset, s.namespace, s.name, mutate)
+}
+
+// updateConfigMap applies mutate to the ConfigMap namespace/name, creating it
+// if needed, and writes it if mutate returns true. Conflicts with the other
+// replicas are retried.
+func updateConfigMap(clientset kubernetes.Interface, namespace string, name string, mutate func(cm *corev1.ConfigMap) bool) error {
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels:    map[string]string{"k8s-app": "kube-git"},
+				},
+				Data: map[string]string{},
+			}
+			if !mutate(cm) {
+				return nil
+			}
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(cm)
+			if errors.IsAlreadyExists(err) {
+				// created by another replica, retry as a conflict
+				return errors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if !mutate(cm) {
+			return nil
+		}
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+		return err
+	})
+}
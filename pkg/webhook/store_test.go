@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestEvent(delivery string, owner string) queuedEvent {
+	return queuedEvent{
+		Event:     pushEvent{Delivery: delivery, Branch: "refs/heads/master", Commit: "0123456789abcdef"},
+		Namespace: "default",
+		Name:      "githook",
+		Owner:     owner,
+	}
+}
+
+func newTestEventStore(t *testing.T, events ...queuedEvent) (*EventStore, *fake.Clientset) {
+	data := map[string]string{}
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[e.key()] = string(b)
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-git", Name: "kube-git-events"}, Data: data},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-git", Name: "alive"}},
+	)
+	return NewEventStore(clientset, "kube-git", "kube-git-events", "self"), clientset
+}
+
+func storedOwners(t *testing.T, clientset *fake.Clientset) map[string]string {
+	cm, err := clientset.CoreV1().ConfigMaps("kube-git").Get("kube-git-events", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := map[string]string{}
+	for key, data := range cm.Data {
+		var e queuedEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+		owners[key] = e.Owner
+	}
+	return owners
+}
+
+func TestEventStoreAddRemove(t *testing.T) {
+	s := NewEventStore(fake.NewSimpleClientset(), "kube-git", "kube-git-events", "self")
+
+	e := newTestEvent("1", "")
+	if err := s.Add(e.key(), e); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := events[e.key()]; !ok || got.Owner != "self" {
+		t.Fatalf("got events %v, want %s owned by self", events, e.key())
+	}
+
+	if err := s.Remove(e.key()); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := s.Recover(); err != nil || len(events) != 0 {
+		t.Fatalf("got events %v and error %v, want none", events, err)
+	}
+}
+
+func TestEventStoreRecover(t *testing.T) {
+	own, dead, alive := newTestEvent("1", "self"), newTestEvent("2", "dead"), newTestEvent("3", "alive")
+
+	tests := []struct {
+		name  string
+		adopt func(s *EventStore) (map[string]queuedEvent, error)
+		want  []string
+	}{
+		{name: "recover", adopt: (*EventStore).Recover, want: []string{own.key(), dead.key()}},
+		{name: "adopt", adopt: (*EventStore).Adopt, want: []string{dead.key()}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, clientset := newTestEventStore(t, own, dead, alive)
+
+			events, err := test.adopt(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(test.want) {
+				t.Errorf("got events %v, want %v", events, test.want)
+			}
+			for _, key := range test.want {
+				if e, ok := events[key]; !ok || e.Owner != "self" {
+					t.Errorf("got events %v, want %s owned by self", events, key)
+				}
+			}
+
+			want := map[string]string{own.key(): "self", dead.key(): "self", alive.key(): "alive"}
+			for key, owner := range storedOwners(t, clientset) {
+				if owner != want[key] {
+					t.Errorf("got owner %q of stored event %s, want %q", owner, key, want[key])
+				}
+			}
+		})
+	}
+}
+
+func TestEventStoreFull(t *testing.T) {
+	s := NewEventStore(fake.NewSimpleClientset(), "kube-git", "kube-git-events", "self")
+
+	e := newTestEvent(strings.Repeat("x", maxEventStoreSize/4), "")
+	if err := s.Add(e.key(), e); err != nil {
+		t.Fatal(err)
+	}
+	// the delivery is in the key and the event, replacing an event doesn't count it twice
+	if err := s.Add(e.key(), e); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestEvent(strings.Repeat("y", maxEventStoreSize/2), "")
+	if err := s.Add(other.key(), other); err == nil || !strings.Contains(err.Error(), "full") {
+		t.Fatalf("got error %v, want the store to be full", err)
+	}
+}
@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// setTektonParam sets the value of the named param in spec.params of a
+// PipelineRun or TaskRun. A param the run does not define is not added.
+func setTektonParam(run *unstructured.Unstructured, name string, value string) error {
+	params, found, err := unstructured.NestedSlice(run.Object, "spec", "params")
+	if err != nil || !found {
+		return err
+	}
+
+	for _, p := range params {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if param["name"] == name {
+			param["value"] = value
+		}
+	}
+
+	return unstructured.SetNestedSlice(run.Object, params, "spec", "params")
+}
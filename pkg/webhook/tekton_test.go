@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetTektonParam(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		spec  map[string]interface{}
+		param string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "defined param",
+			spec:  map[string]interface{}{"params": []interface{}{map[string]interface{}{"name": "revision", "value": ""}}},
+			param: "revision",
+			want:  map[string]interface{}{"params": []interface{}{map[string]interface{}{"name": "revision", "value": "abc"}}},
+		},
+		{
+			name:  "undefined param",
+			spec:  map[string]interface{}{"params": []interface{}{map[string]interface{}{"name": "commit", "value": ""}}},
+			param: "revision",
+			want:  map[string]interface{}{"params": []interface{}{map[string]interface{}{"name": "commit", "value": ""}}},
+		},
+		{
+			name:  "no params",
+			spec:  map[string]interface{}{},
+			param: "revision",
+			want:  map[string]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			run := &unstructured.Unstructured{Object: map[string]interface{}{"spec": test.spec}}
+			if err := setTektonParam(run, test.param, "abc"); err != nil {
+				t.Fatalf("error setting param: %s", err.Error())
+			}
+			if !reflect.DeepEqual(run.Object["spec"], test.want) {
+				t.Errorf("got spec %v, want %v", run.Object["spec"], test.want)
+			}
+		})
+	}
+}
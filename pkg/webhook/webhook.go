@@ -9,21 +9,31 @@ import (
 
 	"k8s.io/klog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
-
-	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1alpha1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	ghapi "github.com/appspero/kube-git/pkg/apis/githook/v1beta1"
 	ghclient "github.com/appspero/kube-git/pkg/client/clientset/versioned"
+	ghscheme "github.com/appspero/kube-git/pkg/client/clientset/versioned/scheme"
 
 	"github.com/appspero/kube-git/pkg/controller"
 	"github.com/appspero/kube-git/pkg/notification"
 	"github.com/appspero/kube-git/pkg/tools"
 	"github.com/appspero/kube-git/pkg/git"
+	"github.com/appspero/kube-git/pkg/metrics"
 	"gopkg.in/go-playground/webhooks.v5/github"
 
 
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	discocache "k8s.io/client-go/discovery/cached"
 	argo "github.com/argoproj/argo/pkg/apis/workflow/v1alpha1"
@@ -36,31 +46,60 @@ type WebhookHandler struct {
   clientset *kubernetes.Clientset
 	wfClientset *wfclient.Clientset
 	ghClientset *ghclient.Clientset
+	dynClientset dynamic.Interface
+	config *rest.Config
+	policy Policy
+	notificationConfig *notification.Config
+	repositoryCache *git.RepositoryCache
+	knownHostsFile string
 	hook *github.Webhook
+	recorder record.EventRecorder
+	events *eventQueue
+	deliveries *DeliveryCache
 }
 
 
-func NewWebhookHandler(controller *controller.Controller, clientset *kubernetes.Clientset, wfClientset *wfclient.Clientset, ghClientset *ghclient.Clientset, secret string) WebhookHandler {
+func NewWebhookHandler(controller *controller.Controller, clientset *kubernetes.Clientset, wfClientset *wfclient.Clientset, ghClientset *ghclient.Clientset, dynClientset dynamic.Interface, config *rest.Config, policy Policy, notificationConfig *notification.Config, repositoryCache *git.RepositoryCache, knownHostsFile string, eventStore *EventStore, locks *BranchLocks, deliveries *DeliveryCache, secret string) WebhookHandler {
 
 	hook, _ := github.New(github.Options.Secret(secret))
 
+	ghscheme.AddToScheme(scheme.Scheme)
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(klog.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kube-git"})
+
 	return WebhookHandler{
 		controller: controller,
 		clientset: clientset,
 		wfClientset: wfClientset,
 		ghClientset: ghClientset,
+		dynClientset: dynClientset,
+		config: config,
+		policy: policy,
+		notificationConfig: notificationConfig,
+		repositoryCache: repositoryCache,
+		knownHostsFile: knownHostsFile,
 		hook: hook,
+		recorder: recorder,
+		events: newEventQueue(eventStore, locks),
+		deliveries: deliveries,
 	}
 }
 
 func (h WebhookHandler) GithubWebhook(w http.ResponseWriter, r *http.Request) {
 
+		delivered := func(result string) {
+			metrics.WebhookDeliveries.WithLabelValues("github", r.Header.Get("X-GitHub-Event"), result).Inc()
+		}
+
 		payload, err := h.hook.Parse(r, github.PushEvent, github.PingEvent)
 		if err != nil {
 			if err == github.ErrEventNotFound {
-
+				// an event kube-git doesn't handle
+				delivered("unsupported")
 			} else {
-
+				delivered("invalid")
 			}
 			w.WriteHeader(400)
 			fmt.Fprintf(w, "%s", err)
@@ -72,97 +111,78 @@ func (h WebhookHandler) GithubWebhook(w http.ResponseWriter, r *http.Request) {
 		case github.PushPayload:
 			push := payload.(github.PushPayload)
 
-			sshURL := push.Repository.SSHURL
-			cloneURL := push.Repository.CloneURL
-			branch := push.Ref
-
-			hash := push.HeadCommit.ID
-			if hash == "" {
-				return
+			event := pushEvent{
+				Delivery: r.Header.Get("X-GitHub-Delivery"),
+				SSHURL: push.Repository.SSHURL,
+				CloneURL: push.Repository.CloneURL,
+				Branch: push.Ref,
+				Commit: push.HeadCommit.ID,
+				Author: push.HeadCommit.Author.Name,
 			}
-
-			author := push.HeadCommit.Author.Name
-
-			// create status annotations
-			annotations := make(map[string]string)
-			annotations["kubegit.appspero.com/branch"] = branch
-			annotations["kubegit.appspero.com/commit"] = hash
-			annotations["kubegit.appspero.com/author"] = author
-
-			// get GitHooks
-			ghs := h.controller.GetGitHooks()
-			if len(ghs) == 0 {
-				klog.Info("No GitHooks")
+			if event.Commit == "" {
+				delivered("ignored")
 				return
 			}
+			if event.Delivery == "" {
+				event.Delivery = fmt.Sprintf("%s-%d", event.Commit, time.Now().UnixNano())
+			}
 
-			for _, gh := range ghs {
-				// if url param match repository
-				if gh.Spec.Repository == sshURL || gh.Spec.Repository == cloneURL {
-
-					ghFullname := gh.Namespace + "/" + gh.Name
-					klog.Infof("Found GitHook for GitHub payload: %s", ghFullname)
-
-					// if no matched branch, continue
-					if !matchBranch(gh.Spec.Branches, branch) {
-						klog.Infof("No branches matched the found GitHook '%s' branchs: %s", ghFullname, branch)
-						continue
-					}
-
-					annotations["kubegit.appspero.com/githook"] = ghFullname
-					annotations["kubegit.appspero.com/repository"] = gh.Spec.Repository
-
-					var username []byte
-					var password []byte
-					var sshKey []byte
-
-					if gh.Spec.SshPrivateKeySecret.Name != "" {
-						sshPrivateKeySecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(gh.Spec.SshPrivateKeySecret.Name, metav1.GetOptions{})
-						if err != nil {
-							klog.Errorf("Error getting secret of %s GitHook: %s", ghFullname, err.Error())
-							continue
-						}
-						sshKey = sshPrivateKeySecret.Data[gh.Spec.SshPrivateKeySecret.Key]
-					}
+			ghs := h.matchGitHooks(event)
 
-					// getting username and password from Secrets
-					if gh.Spec.UsernameSecret.Name != "" && gh.Spec.PasswordSecret.Name != "" {
-						usernameSecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(gh.Spec.UsernameSecret.Name, metav1.GetOptions{})
-						if err != nil {
-							klog.Errorf("Error getting secret of %s GitHook: %s", ghFullname, err.Error())
-							continue
-						}
-						passwordSecret, err := h.clientset.CoreV1().Secrets(gh.Namespace).Get(gh.Spec.PasswordSecret.Name, metav1.GetOptions{})
-						if err != nil {
-							klog.Errorf("Error getting secret of %s GitHook: %s", ghFullname, err.Error())
-							continue
-						}
-						username = usernameSecret.Data[gh.Spec.UsernameSecret.Key]
-						password = passwordSecret.Data[gh.Spec.PasswordSecret.Key]
+			// GitHub redelivers the webhooks that timed out
+			if h.deliveries != nil {
+				if reason := h.deliveries.add(event); reason != "" {
+					klog.Infof("Skipping duplicate push %s: %s", event.Delivery, reason)
+					for _, gh := range ghs {
+						h.recorder.Eventf(gh, corev1.EventTypeNormal, "DuplicateDelivery", "Push %s skipped: %s", event.Delivery, reason)
 					}
+					delivered("duplicate")
+					w.WriteHeader(http.StatusOK)
+					fmt.Fprintf(w, "duplicate: %s", reason)
+					return
+				}
+			}
 
-					manifest, err := git.FetchGitFile(gh.Spec.Repository, branch, username, password, sshKey, hash, gh.Spec.Manifest)
-					if err != nil {
-						klog.Errorf("Error Fetch files from git repository (%s): %s", gh.Spec.Repository, err.Error())
-						continue
-					}
-					klog.Infof("Applying GitHook of GitHub payload: %s", ghFullname)
-					// Apply Manifest
-					go h.ApplyGitHook(manifest, gh, annotations)
+			// the manifests are fetched and applied by the workers
+			count, err := h.enqueue(event, ghs)
+			if err != nil {
+				klog.Errorf("Error queueing push %s: %s", event.Delivery, err.Error())
+				if h.deliveries != nil {
+					// accept the redelivery
+					h.deliveries.remove(event)
 				}
+				delivered("error")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "%s", err)
+				return
+			}
+			delivered("queued")
+			if count == 0 {
+				klog.Infof("No GitHooks for push %s of %s", event.Delivery, event.Branch)
 			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "queued for %d GitHooks", count)
+			return
 
 		case github.PingPayload:
+			delivered("ping")
 			w.WriteHeader(200)
 			return
 		}
 
 }
 
-func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotations map[string]string) {
+// ApplyGitHook creates the resource of the manifest for the push. errRunning is
+// returned if the push is queued by the concurrency policy of the GitHook.
+func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotations map[string]string) error {
 
 	ghFullname := annotations["kubegit.appspero.com/githook"]
 
+	kind, applyResult := "", "invalid"
+	defer func() {
+		metrics.Applies.WithLabelValues(kind, applyResult).Inc()
+	}()
+
 	var appliedResource ghapi.ResourceSpec
 
 	dis := h.clientset.Discovery()
@@ -176,55 +196,74 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 	ext := runtime.RawExtension{}
 	if err := decoder.Decode(&ext); err != nil {
 		klog.Errorf("Error decoding manifest of GitHook (%s): %s", ghFullname, err.Error())
-		return
+		return nil
 	}
 
 	versions := &runtime.VersionedObjects{}
 	_, gvk, err := unstructured.UnstructuredJSONScheme.Decode(ext.Raw, nil, versions)
 	if err != nil {
 		klog.Errorf("Error decoding manifest of GitHook (%s): %s", ghFullname, err.Error())
-		return
+		return nil
 	}
 
+	kind = gvk.Kind
+
 	mapping, err := restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
 		klog.Errorf("Error in RESTMapping of GitHook (%s): %s", ghFullname, err.Error())
-		return
+		return nil
+	}
+
+	// the resources are created as the ServiceAccount of the GitHook
+	clients, err := h.applyClients(gh)
+	if err != nil {
+		klog.Errorf("Error creating clients of GitHook (%s): %s", ghFullname, err.Error())
+		applyResult = "error"
+		return nil
 	}
 
+	// not a Workflow, Job or Tekton run
+	applyResult = "unsupported"
+
 	// if type is Workflow
 	if (mapping.GroupVersionKind.Group == "argoproj.io" && mapping.GroupVersionKind.Version == "v1alpha1" && mapping.GroupVersionKind.Kind == "Workflow") {
 
 		var workflow argo.Workflow
 		if err := json.Unmarshal(ext.Raw, &workflow); err != nil {
 			klog.Errorf("Error parsing argo workflow of GitHook (%s): %s", ghFullname, err.Error())
-			return
+			return nil
 		}
 
 		if gh.Spec.TimestampSuffix && workflow.ObjectMeta.Name != "" {
 			workflow.ObjectMeta.Name = workflow.ObjectMeta.Name + "-" + time.Now().Format("20060102150405")
 		}
 
-		// Set Revision Parameter
-		if gh.Spec.ArgoWorkflow != nil {
-			if gh.Spec.ArgoWorkflow.RevisionParameterName != "" {
-				for _, p := range workflow.Spec.Arguments.Parameters {
-					if p.Name == gh.Spec.ArgoWorkflow.RevisionParameterName {
-						*p.Value = annotations["kubegit.appspero.com/commit"]
-					}
-					if p.Name == gh.Spec.ArgoWorkflow.BranchParameterName {
-						*p.Value = annotations["kubegit.appspero.com/branch"]
-					}
+		// Set Revision and Branch Parameters
+		for _, param := range gh.Spec.Parameters {
+			for i, p := range workflow.Spec.Arguments.Parameters {
+				if p.Name == param.Name {
+					value := parameterValue(param, annotations)
+					workflow.Spec.Arguments.Parameters[i].Value = &value
 				}
 			}
 		}
 
 		// set namespace
-		ns := "default"
+		ns := gh.Namespace
 		if workflow.Namespace != "" {
 			ns = workflow.Namespace
 		}
 
+		if !h.allowed(gh, mapping.GroupVersionKind.Kind, ns) {
+			applyResult = "rejected"
+			return nil
+		}
+
+		if create, err := h.checkConcurrency(clients, gh, mapping, ns, annotations); !create {
+			applyResult = concurrencyResult(err)
+			return err
+		}
+
 		if workflow.ObjectMeta.Annotations == nil {
 			workflow.ObjectMeta.Annotations = make(map[string]string)
 		}
@@ -234,14 +273,22 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 		for k, v := range annotations {
 			workflow.ObjectMeta.Annotations[k] = v
 		}
+		if workflow.ObjectMeta.Labels == nil {
+			workflow.ObjectMeta.Labels = make(map[string]string)
+		}
+		workflow.ObjectMeta.Labels[controller.GitHookUIDLabel] = string(gh.UID)
+		setOwner(&workflow, gh, ns)
 
 		// create Workflow
-		result, err := h.wfClientset.ArgoprojV1alpha1().Workflows(ns).Create(&workflow)
+		result, err := clients.wfClientset.ArgoprojV1alpha1().Workflows(ns).Create(&workflow)
 		if err != nil {
 			klog.Errorf("Error RESTMapping of GitHook (%s): %s", ghFullname, err.Error())
-			return
+			h.createFailed(gh, "Workflow", ns, err)
+			applyResult = "error"
+			return nil
 		}
 
+		applyResult = "created"
 		appliedResource = ghapi.ResourceSpec{
 			APIVersion: mapping.GroupVersionKind.Group + "/" + mapping.GroupVersionKind.Version,
 			Kind: mapping.GroupVersionKind.Kind,
@@ -254,7 +301,7 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 		var job batch.Job
 		if err := json.Unmarshal(ext.Raw, &job); err != nil {
 			klog.Errorf("Error parsing job of GitHook (%s): %s", ghFullname, err.Error())
-			return
+			return nil
 		}
 
 		if gh.Spec.TimestampSuffix && job.ObjectMeta.Name != "" {
@@ -262,11 +309,21 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 		}
 
 		// set namespace
-		ns := "default"
+		ns := gh.Namespace
 		if job.Namespace != "" {
 			ns = job.Namespace
 		}
 
+		if !h.allowed(gh, mapping.GroupVersionKind.Kind, ns) {
+			applyResult = "rejected"
+			return nil
+		}
+
+		if create, err := h.checkConcurrency(clients, gh, mapping, ns, annotations); !create {
+			applyResult = concurrencyResult(err)
+			return err
+		}
+
 		if job.ObjectMeta.Annotations == nil {
 			job.ObjectMeta.Annotations = make(map[string]string)
 		}
@@ -276,14 +333,22 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 		for k, v := range annotations {
 			job.ObjectMeta.Annotations[k] = v
 		}
+		if job.ObjectMeta.Labels == nil {
+			job.ObjectMeta.Labels = make(map[string]string)
+		}
+		job.ObjectMeta.Labels[controller.GitHookUIDLabel] = string(gh.UID)
+		setOwner(&job, gh, ns)
 
 		// create Workflow
-		result, err := h.clientset.BatchV1().Jobs(ns).Create(&job)
+		result, err := clients.clientset.BatchV1().Jobs(ns).Create(&job)
 		if err != nil {
 			klog.Errorf("Error RESTMapping of GitHook (%s): %s", ghFullname, err.Error())
-			return
+			h.createFailed(gh, "Job", ns, err)
+			applyResult = "error"
+			return nil
 		}
 
+		applyResult = "created"
 		appliedResource = ghapi.ResourceSpec{
 			APIVersion: mapping.GroupVersionKind.Group + "/" + mapping.GroupVersionKind.Version,
 			Kind: mapping.GroupVersionKind.Kind,
@@ -291,26 +356,198 @@ func (h WebhookHandler) ApplyGitHook(manifest []byte, gh *ghapi.GitHook, annotat
 			Namespace: result.Namespace,
 		}
 
+	} else if (mapping.GroupVersionKind.Group == "tekton.dev" && mapping.GroupVersionKind.Version == "v1beta1" && (mapping.GroupVersionKind.Kind == "PipelineRun" || mapping.GroupVersionKind.Kind == "TaskRun")) {
+
+		run := &unstructured.Unstructured{}
+		if err := run.UnmarshalJSON(ext.Raw); err != nil {
+			klog.Errorf("Error parsing tekton %s of GitHook (%s): %s", mapping.GroupVersionKind.Kind, ghFullname, err.Error())
+			return nil
+		}
+
+		if gh.Spec.TimestampSuffix && run.GetName() != "" {
+			run.SetName(run.GetName() + "-" + time.Now().Format("20060102150405"))
+		}
+
+		// Set Revision and Branch Parameters
+		for _, param := range gh.Spec.Parameters {
+			if err := setTektonParam(run, param.Name, parameterValue(param, annotations)); err != nil {
+				klog.Errorf("Error setting tekton params of GitHook (%s): %s", ghFullname, err.Error())
+				return nil
+			}
+		}
+
+		// set namespace
+		ns := gh.Namespace
+		if run.GetNamespace() != "" {
+			ns = run.GetNamespace()
+		}
+
+		if !h.allowed(gh, mapping.GroupVersionKind.Kind, ns) {
+			applyResult = "rejected"
+			return nil
+		}
+
+		if create, err := h.checkConcurrency(clients, gh, mapping, ns, annotations); !create {
+			applyResult = concurrencyResult(err)
+			return err
+		}
+
+		runAnnotations := run.GetAnnotations()
+		if runAnnotations == nil {
+			runAnnotations = make(map[string]string)
+		}
+		for k, v := range notification.GetNotificationAnnotations(gh) {
+			runAnnotations[k] = v
+		}
+		for k, v := range annotations {
+			runAnnotations[k] = v
+		}
+		run.SetAnnotations(runAnnotations)
+
+		runLabels := run.GetLabels()
+		if runLabels == nil {
+			runLabels = make(map[string]string)
+		}
+		runLabels[controller.GitHookUIDLabel] = string(gh.UID)
+		run.SetLabels(runLabels)
+		setOwner(run, gh, ns)
+
+		// create PipelineRun or TaskRun
+		result, err := clients.dynClientset.Resource(mapping.Resource).Namespace(ns).Create(run, metav1.CreateOptions{})
+		if err != nil {
+			klog.Errorf("Error creating tekton %s of GitHook (%s): %s", mapping.GroupVersionKind.Kind, ghFullname, err.Error())
+			h.createFailed(gh, mapping.GroupVersionKind.Kind, ns, err)
+			applyResult = "error"
+			return nil
+		}
+
+		applyResult = "created"
+		appliedResource = ghapi.ResourceSpec{
+			APIVersion: mapping.GroupVersionKind.Group + "/" + mapping.GroupVersionKind.Version,
+			Kind: mapping.GroupVersionKind.Kind,
+			Name: result.GetName(),
+			Namespace: result.GetNamespace(),
+		}
+
 	}
 
 	h.UpdateGitHook(gh, annotations, appliedResource)
+	return nil
+}
+
+// parameterValue is the value of the push a parameter of the GitHook is set to
+func parameterValue(param ghapi.Parameter, annotations map[string]string) string {
+	switch param.Value {
+	case ghapi.RevisionValue:
+		return annotations["kubegit.appspero.com/commit"]
+	case ghapi.BranchValue:
+		return annotations["kubegit.appspero.com/branch"]
+	}
+	return ""
+}
+
+// concurrencyResult is the apply metric result of a push not applied for the
+// concurrency policy
+func concurrencyResult(err error) string {
+	switch err {
+	case nil:
+		return "skipped"
+	case errRunning:
+		return "queued"
+	}
+	return "error"
+}
+
+// setOwner sets an ownerReference to the GitHook on a resource created in its
+// namespace, so the resource is deleted with the GitHook
+func setOwner(obj metav1.Object, gh *ghapi.GitHook, namespace string) {
+	if gh.Spec.DisableOwnerReferences || namespace != gh.Namespace {
+		return
+	}
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), metav1.OwnerReference{
+		APIVersion: ghapi.SchemeGroupVersion.String(),
+		Kind: "GitHook",
+		Name: gh.Name,
+		UID: gh.UID,
+	}))
 }
 
 func (h WebhookHandler) UpdateGitHook(gh *ghapi.GitHook, annotations map[string]string, appliedResource ghapi.ResourceSpec) {
 	ghFullname := gh.Namespace + "/" + gh.Name
-	gh.Status.LastCommit = annotations["kubegit.appspero.com/commit"]
-	gh.Status.Author = annotations["kubegit.appspero.com/author"]
-	gh.Status.Branch = annotations["kubegit.appspero.com/branch"]
-	gh.Status.TriggerCount = gh.Status.TriggerCount + 1
-	gh.Status.AppliedResource = appliedResource
-	gh.Status.LastTrigger = metav1.Time{Time: time.Now().UTC()}
-	_, err := h.ghClientset.KubegitV1alpha1().GitHooks(gh.Namespace).UpdateStatus(gh)
+	err := h.updateStatus(gh, func(status *ghapi.GitHookStatus) {
+		status.LastCommit = annotations["kubegit.appspero.com/commit"]
+		status.Author = annotations["kubegit.appspero.com/author"]
+		status.Branch = annotations["kubegit.appspero.com/branch"]
+		status.TriggerCount = status.TriggerCount + 1
+		status.AppliedResource = appliedResource
+		status.LastTrigger = metav1.Time{Time: time.Now().UTC()}
+	})
 	if err != nil {
 		klog.Errorf("Error updating status of GitHook (%s): %s", ghFullname, err.Error())
 	}
 }
 
-func matchBranch(branches []string, branch string) bool {
+func (h WebhookHandler) UpdateGitHookStatus(gh *ghapi.GitHook) {
+	err := h.updateStatus(gh, func(status *ghapi.GitHookStatus) {})
+	if err != nil {
+		klog.Errorf("Error updating status of GitHook (%s): %s", gh.Namespace + "/" + gh.Name, err.Error())
+	}
+}
+
+// updateStatus applies mutate and the conditions of gh to the status and
+// updates it. Any replica can receive a push, so on conflicts the latest
+// GitHook is read and the changes are applied again.
+func (h WebhookHandler) updateStatus(gh *ghapi.GitHook, mutate func(status *ghapi.GitHookStatus)) error {
+
+	conditions := gh.Status.Conditions
+	latest := gh
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		status := latest.Status.DeepCopy()
+		for _, condition := range conditions {
+			setGitHookCondition(status, condition)
+		}
+		mutate(status)
+
+		update := latest.DeepCopy()
+		update.Status = *status
+		_, err := h.ghClientset.KubegitV1beta1().GitHooks(gh.Namespace).UpdateStatus(update)
+		if errors.IsConflict(err) {
+			if current, getErr := h.ghClientset.KubegitV1beta1().GitHooks(gh.Namespace).Get(gh.Name, metav1.GetOptions{}); getErr == nil {
+				latest = current
+			}
+		}
+		return err
+	})
+}
+
+func getGitHookCondition(status ghapi.GitHookStatus, conditionType ghapi.GitHookConditionType) *ghapi.GitHookCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setGitHookCondition adds or replaces the condition of the same type, keeping
+// the last transition time if the status didn't change
+func setGitHookCondition(status *ghapi.GitHookStatus, condition ghapi.GitHookCondition) {
+	condition.LastTransitionTime = metav1.Time{Time: time.Now().UTC()}
+	existing := getGitHookCondition(*status, condition.Type)
+	if existing == nil {
+		status.Conditions = append(status.Conditions, condition)
+		return
+	}
+	if existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	}
+	*existing = condition
+}
+
+// MatchBranch returns whether one of the branch patterns of a GitHook matches
+// the full ref of a pushed branch, eg. refs/heads/main
+func MatchBranch(branches []string, branch string) bool {
 	for _, b := range branches {
 		if tools.Glob(b, branch) {
 			return true
@@ -319,10 +556,16 @@ func matchBranch(branches []string, branch string) bool {
 	return false
 }
 
-/*
-eventBroadcaster := record.NewBroadcaster()
-eventBroadcaster.StartLogging(klog.Infof)
-eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: h.client.CoreV1().Events("")})
-recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "controllerAgentName"})
-recorder.Event(gh, corev1.EventTypeWarning, "ErrResourceExists", "msg")
-*/
+// notifyFailed sends the FAILED status notifications of a GitHook that wasn't
+// applied
+func (h WebhookHandler) notifyFailed(gh *ghapi.GitHook, annotations map[string]string) {
+
+	notificationAnnotations := notification.GetNotificationAnnotations(gh)
+	if !notification.ShouldNotify(notificationAnnotations) {
+		return
+	}
+	for k, v := range annotations {
+		notificationAnnotations[k] = v
+	}
+	h.notificationConfig.Notify("FAILED", "GitHook", gh.Namespace, gh.Name, notificationAnnotations)
+}